@@ -1,17 +1,27 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
 
-func command(log *logger, homedir string) *cobra.Command {
+func command(log *logger, homedir string, project *string) *cobra.Command {
 	var config string
 	parser := &parser{
 		log:     log,
@@ -23,37 +33,93 @@ func command(log *logger, homedir string) *cobra.Command {
 		Short: "Start all processes",
 		Args:  cobra.NoArgs,
 		RunE: func(c *cobra.Command, _ []string) error {
+			parser.project = *project
 			settings, registry, err := parser.parseConfig(config)
 			if err != nil {
 				return err
 			}
 
+			runner := &processor{
+				log:       log,
+				reg:       registry,
+				terminate: make(chan []string, len(registry.processes())),
+				errors:    make(chan error, len(registry.processes())),
+				subreaper: settings.Subreaper,
+				usage:     settings.Usage,
+				done:      make(chan struct{}),
+			}
+
+			control, err := serveControl(runner, settings.Project)
+			if err != nil {
+				return err
+			}
+			defer control.Close()
+
+			if !c.Flags().Changed("log-format") {
+				if err = log.setFormat(settings.LogFormat); err != nil {
+					return err
+				}
+			}
+
+			if !c.Flags().Changed("timestamps") {
+				if err = log.setTimestamps(settings.Timestamps); err != nil {
+					return err
+				}
+			}
+
+			if !c.Flags().Changed("log-level") {
+				if err = log.setLevel(settings.LogLevel); err != nil {
+					return err
+				}
+			}
+
+			defer log.files.Close()
+
 			if settings.LogFile != "" {
-				f, err := os.OpenFile(settings.LogFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
-				if err != nil {
+				f := newRotatingFile(projectFile(settings.LogFile, settings.Project), settings.LogRotation)
+				if err = f.open(); err != nil {
 					return err
 				}
 				defer f.Close()
 
-				log.w = f
+				log.setOutput(f)
 			}
 
-			runner := &processor{
-				log:       log,
-				reg:       registry,
-				terminate: make(chan []string, len(registry.processes())),
-				errors:    make(chan error, len(registry.processes())),
+			if err = log.sinks.open(settings.LogSinks, settings.Project); err != nil {
+				return err
 			}
-			defer runner.shutdown()
+			defer log.sinks.Close()
 
-			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			// Only the services asking for it receive the composer's input
+			input := newStdinMux(log)
+			var interactive bool
+			for _, p := range registry.processes() {
+				if p.Stdin {
+					p.input = input
+					interactive = true
+				}
+			}
+			if interactive {
+				go input.forward(os.Stdin)
+			}
 
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			// Processes are stopped by the shutdown, not by the signal,
+			// so their pre_stop hooks run before they are interrupted
+			performed := make(chan struct{})
 			go func() {
-				runner.perform(ctx)
-				stop()
+				runner.perform(context.Background())
+				close(performed)
 			}()
 
-			<-ctx.Done()
+			select {
+			case <-ctx.Done():
+			case <-performed:
+			}
+
+			runner.shutdown()
 			return nil
 		},
 	}
@@ -62,6 +128,246 @@ func command(log *logger, homedir string) *cobra.Command {
 	return command
 }
 
+func taskCommand(log *logger, homedir string, project *string) *cobra.Command {
+	var config string
+	parser := &parser{
+		log:     log,
+		homedir: homedir,
+	}
+
+	command := &cobra.Command{
+		Use:   "task NAME",
+		Short: "Run the given task and its dependencies",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			c.SilenceUsage = true
+
+			parser.project = *project
+			settings, tasks, err := parser.parseTask(config, args[0])
+			if err != nil {
+				return err
+			}
+
+			if !c.Flags().Changed("log-format") {
+				if err = log.setFormat(settings.LogFormat); err != nil {
+					return err
+				}
+			}
+
+			if !c.Flags().Changed("timestamps") {
+				if err = log.setTimestamps(settings.Timestamps); err != nil {
+					return err
+				}
+			}
+
+			if !c.Flags().Changed("log-level") {
+				if err = log.setLevel(settings.LogLevel); err != nil {
+					return err
+				}
+			}
+
+			defer log.files.Close()
+
+			if settings.LogFile != "" {
+				f := newRotatingFile(projectFile(settings.LogFile, settings.Project), settings.LogRotation)
+				if err = f.open(); err != nil {
+					return err
+				}
+				defer f.Close()
+
+				log.setOutput(f)
+			}
+
+			if err = log.sinks.open(settings.LogSinks, settings.Project); err != nil {
+				return err
+			}
+			defer log.sinks.Close()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			return runTasks(ctx, tasks)
+		},
+	}
+	command.Flags().StringVarP(&config, "config", "c", "", "Configuration file")
+
+	return command
+}
+
+func psCommand(project *string) *cobra.Command {
+	var config string
+
+	command := &cobra.Command{
+		Use:   "ps",
+		Short: "List the services of the running composer",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			c.SilenceUsage = true
+
+			name, err := controlProject(*project, config)
+			if err != nil {
+				return err
+			}
+
+			resp, err := controlClient(name).Get("http://composer/ps")
+			if err != nil {
+				return errors.Wrap(err, "composer is not running")
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return errors.Errorf("control API: %s", resp.Status)
+			}
+
+			var states []serviceState
+			if err = json.NewDecoder(resp.Body).Decode(&states); err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSTATUS\tEXIT\tCPU\tRSS\tTHREADS\tFDS") //nolint: errcheck
+			for _, s := range states {
+				cpu, rss, threads, fds := "-", "-", "-", "-"
+				if s.Usage != nil {
+					cpu = fmt.Sprintf("%.1f%%", s.Usage.CPU)
+					rss = formatBytes(s.Usage.RSS)
+					threads = strconv.Itoa(s.Usage.Threads)
+					fds = strconv.Itoa(s.Usage.FDs)
+				}
+
+				exit := s.Exit
+				if exit == "" {
+					exit = "-"
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, s.Status, exit, cpu, rss, threads, fds) //nolint: errcheck
+			}
+			return w.Flush()
+		},
+	}
+	command.Flags().StringVarP(&config, "config", "c", "", "Configuration file, to read the project from its settings")
+
+	return command
+}
+
+func scaleCommand(project *string) *cobra.Command {
+	var config string
+
+	command := &cobra.Command{
+		Use:   "scale SERVICE=REPLICAS...",
+		Short: "Set the number of replicas of services of the running composer",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			c.SilenceUsage = true
+
+			name, err := controlProject(*project, config)
+			if err != nil {
+				return err
+			}
+
+			var requests []scaleRequest
+			for _, arg := range args {
+				service, value, ok := strings.Cut(arg, "=")
+				replicas, err := strconv.Atoi(value)
+				if !ok || err != nil {
+					return errors.Errorf("invalid argument %s, expected SERVICE=REPLICAS", arg)
+				}
+				requests = append(requests, scaleRequest{Service: service, Replicas: replicas})
+			}
+
+			for _, req := range requests {
+				body, err := json.Marshal(req)
+				if err != nil {
+					return err
+				}
+
+				resp, err := controlClient(name).Post("http://composer/scale", "application/json", bytes.NewReader(body))
+				if err != nil {
+					return errors.Wrap(err, "composer is not running")
+				}
+
+				msg, _ := io.ReadAll(resp.Body)
+				resp.Body.Close() //nolint: errcheck
+
+				if resp.StatusCode != http.StatusNoContent {
+					return errors.Errorf("%s: %s", req.Service, strings.TrimSpace(string(msg)))
+				}
+			}
+
+			return nil
+		},
+	}
+	command.Flags().StringVarP(&config, "config", "c", "", "Configuration file, to read the project from its settings")
+
+	return command
+}
+
+// controlProject returns the project of the running composer to control,
+// the project flag takes precedence over the settings of the given configuration file.
+func controlProject(flag, config string) (string, error) {
+	if flag != "" || config == "" {
+		return projectName(flag, "")
+	}
+
+	raw, err := (&parser{}).readConfig(config)
+	if err != nil {
+		return "", err
+	}
+
+	var cfg struct {
+		Settings struct {
+			Project string `yaml:"project"`
+		} `yaml:"settings"`
+	}
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return "", err
+	}
+	if err = yaml.Unmarshal(data, &cfg); err != nil {
+		return "", errors.Wrap(err, "could not parse settings")
+	}
+
+	return projectName("", cfg.Settings.Project)
+}
+
+// limitCommand is used internally to apply the rlimits to a command before it starts.
+func limitCommand() *cobra.Command {
+	rlimits := make(map[string]*string)
+
+	command := &cobra.Command{
+		Use:    "limit [--nofile N] [--nproc N] [--core N] -- PATH ARGV...",
+		Short:  "Execute the given command with resource limits",
+		Hidden: true,
+		Args:   cobra.MinimumNArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			values := make(map[string]uint64)
+			for name, value := range rlimits {
+				if !c.Flags().Changed(name) {
+					continue
+				}
+
+				n, err := strconv.ParseUint(*value, 10, 64)
+				if err != nil {
+					return errors.Wrapf(err, "invalid %s", name)
+				}
+				values[name] = n
+			}
+
+			return execWithRlimits(values, args[0], args[1:], os.Environ())
+		},
+	}
+
+	for _, name := range []string{"nofile", "nproc", "core"} {
+		rlimits[name] = command.Flags().String(name, "", "Limit of "+name)
+	}
+
+	return command
+}
+
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+}
+
 // ----------------
 // -------------
 // Config
@@ -69,57 +375,295 @@ func command(log *logger, homedir string) *cobra.Command {
 // ---
 
 type parser struct {
-	log     *logger
-	homedir string
+	log      *logger
+	homedir  string
+	project  string
+	logDir   string
+	rotation logRotation
 }
 
 type settings struct {
-	LogFile string `yaml:"log_file"`
+	Project     string        `yaml:"project"`
+	LogFile     string        `yaml:"log_file"`
+	LogDir      string        `yaml:"log_dir"` // one log file per service
+	LogRotation logRotation   `yaml:"log_rotation"`
+	LogFormat   string        `yaml:"log_format"`
+	Timestamps  string        `yaml:"timestamps"` // rfc3339, time, relative or delta
+	LogLevel    string        `yaml:"log_level"`
+	Redact      []string      `yaml:"redact"`    // patterns of the secrets hidden from the output
+	Subreaper   bool          `yaml:"subreaper"` // Linux only
+	Usage       usageSettings `yaml:"usage"`     // Linux only
+
+	LogSinks []*sinkSettings `yaml:"log_sinks"` // syslog or journald
+}
+
+type usageSettings struct {
+	Interval time.Duration `yaml:"interval"`
+	Summary  time.Duration `yaml:"summary"` // period of the summary line, disabled when zero
 }
 
 func (ps *parser) parseConfig(path string) (*settings, *registry, error) {
-	file, err := os.Open(path)
+	raw, err := ps.readConfig(path)
 	if err != nil {
 		return nil, nil, err
 	}
-	defer file.Close()
 
-	data, err := io.ReadAll(file)
+	settings, err := ps.parseSettings(raw["settings"])
 	if err != nil {
 		return nil, nil, err
 	}
 
-	raw := make(map[string]any)
-	err = yaml.Unmarshal(data, &raw)
+	services, sets, err := ps.parseServices(raw["services"])
 	if err != nil {
 		return nil, nil, err
 	}
 
-	settings, err := ps.parseSettings(raw["settings"])
+	tasks, err := ps.parseTasks(raw["tasks"])
 	if err != nil {
 		return nil, nil, err
 	}
 
+	expandReplicas(services, sets)
+	expandReplicas(tasks, sets)
+
+	if err = resolvePorts(sets, services, tasks); err != nil {
+		return nil, nil, err
+	}
+
 	reg := newRegistry()
-	services, err := ps.parseServices(raw["services"])
+	var awaited []string
+
+	for _, set := range sets {
+		if _, ok := tasks[set.name]; ok {
+			return nil, nil, errors.Errorf("%s is defined both as a service and a task", set.name)
+		}
+
+		// Prepares the replicas added at runtime
+		set.prepare = func(p *process) error {
+			expandReplicas(map[string]*process{p.Name: p}, sets)
+			ps.prepare(p.Name, p, tasks)
+			ps.log.colors.alias(p.Name, set.name)
+
+			if err := p.allocatePorts(); err != nil {
+				return err
+			}
+			if err := p.resolvePorts(reg.lookupPorts); err != nil {
+				return err
+			}
+
+			for _, c := range p.Hooks.Wait {
+				if c.pattern == nil {
+					continue
+				}
+
+				awaited, ok := reg.lookup(c.Service)
+				if !ok {
+					return errors.Errorf("cannot wait log of unknown service %s", c.Service)
+				}
+				p.awaitLog(c, awaited)
+			}
+			return nil
+		}
+		reg.registerReplicaSet(set)
+	}
+
+	for name, p := range services {
+		if _, ok := tasks[name]; ok {
+			return nil, nil, errors.Errorf("%s is defined both as a service and a task", name)
+		}
+
+		for _, c := range p.Hooks.Wait {
+			if _, ok := tasks[c.Service]; ok {
+				awaited = append(awaited, c.Service)
+			}
+		}
+
+		ps.prepare(name, p, tasks)
+		reg.register(p)
+	}
+
+	// Only the tasks awaited by a service are run along the services
+	order, err := resolveTasks(tasks, awaited...)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	for _, t := range order {
+		reg.register(t)
+	}
+
+	// The replicas share the color of their service
+	var names []string
 	for name, p := range services {
-		p.Name = name
-		p.Done = make(chan struct{})
-		p.Logger = ps.log
-		if len(p.Hooks["wait"]) != 0 {
-			p.waiting, p.doneWaiting = context.WithCancel(context.Background())
+		if set, ok := sets[p.replicaOf]; ok {
+			name = set.name
+			if p.color != "" {
+				ps.log.colors.set(name, p.color) // no palette color taken by the replicated service
+			}
+		}
+		names = append(names, name)
+	}
+	for _, t := range order {
+		names = append(names, t.Name)
+	}
+	ps.log.colors.assign(names)
+	for name, p := range services {
+		if p.replicaOf != "" {
+			ps.log.colors.alias(name, p.replicaOf)
 		}
-		p.homedir = ps.homedir
-		reg.register(p)
 	}
 
+	if err = ps.watchLogs(reg); err != nil {
+		return nil, nil, err
+	}
+	linkOutputs(reg.processes())
+
 	return settings, reg, nil
 }
 
+func (ps *parser) parseTask(path string, name string) (*settings, []*process, error) {
+	raw, err := ps.readConfig(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	settings, err := ps.parseSettings(raw["settings"])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tasks, err := ps.parseTasks(raw["tasks"])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, ok := tasks[name]; !ok {
+		return nil, nil, errors.Errorf("unknown task %s", name)
+	}
+
+	if err = resolvePorts(nil, tasks); err != nil {
+		return nil, nil, err
+	}
+
+	order, err := resolveTasks(tasks, name)
+	linkOutputs(order)
+
+	var names []string
+	for _, t := range order {
+		names = append(names, t.Name)
+	}
+	ps.log.colors.assign(names)
+
+	return settings, order, err
+}
+
+func (ps *parser) readConfig(path string) (map[string]any, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]any)
+	err = yaml.Unmarshal(data, &raw)
+	return raw, err
+}
+
+// resolvePorts allocates the ports of the given processes then resolves their references to each other's ports.
+func resolvePorts(sets map[string]*replicaSet, groups ...map[string]*process) error {
+	processes := make(map[string]*process)
+	for _, group := range groups {
+		for name, p := range group {
+			if err := p.allocatePorts(); err != nil {
+				return errors.Wrap(err, name)
+			}
+			processes[name] = p
+		}
+	}
+
+	lookup := func(name string) (*process, error) {
+		if _, ok := sets[name]; ok {
+			return nil, errReplicatedPorts(name)
+		}
+		if p, ok := processes[name]; ok {
+			return p, nil
+		}
+		return nil, errors.Errorf("unknown service %s", name)
+	}
+	for name, p := range processes {
+		if err := p.resolvePorts(lookup); err != nil {
+			return errors.Wrap(err, name)
+		}
+	}
+	return nil
+}
+
+func (ps *parser) prepare(name string, p *process, tasks map[string]*process) {
+	p.Name = name
+	p.Done = make(chan struct{})
+	p.restarts = make(chan struct{}, 1)
+	p.Logger = ps.log
+	if p.Environment == nil {
+		p.Environment = make(map[string]string)
+	}
+	p.Environment["COMPOSER_PROJECT"] = ps.project
+	ps.log.redactor.addSecrets(p.Environment)
+	if p.color != "" {
+		ps.log.colors.set(name, p.color)
+	}
+	if p.logLevel != levelUnknown {
+		ps.log.levels.set(name, p.logLevel)
+	}
+
+	logFile := p.LogFile
+	if logFile == "" && ps.logDir != "" {
+		logFile = filepath.Join(ps.logDir, name+".log")
+	}
+	if logFile != "" {
+		ps.log.files.set(name, newRotatingFile(projectFile(logFile, ps.project), ps.rotation))
+	}
+	p.awaitSuccess = make(map[string]bool)
+	for _, c := range p.Hooks.Wait {
+		if _, ok := tasks[c.Service]; ok && c.pattern == nil {
+			p.awaitSuccess[c.Service] = true
+		}
+	}
+	if len(p.Hooks.Wait) != 0 {
+		p.waiting, p.doneWaiting = context.WithCancel(context.Background())
+	}
+	p.homedir = ps.homedir
+}
+
+// watchLogs registers the log based wait conditions on the awaited processes.
+func (ps *parser) watchLogs(reg *registry) error {
+	processes := make(map[string]*process)
+	for _, p := range reg.processes() {
+		processes[p.Name] = p
+	}
+
+	for _, p := range processes {
+		for _, c := range p.Hooks.Wait {
+			if c.pattern == nil {
+				continue
+			}
+
+			awaited, ok := processes[c.Service]
+			if !ok {
+				return errors.Errorf("%s: cannot wait log of unknown service %s", p.Name, c.Service)
+			}
+
+			p.awaitLog(c, awaited)
+		}
+	}
+
+	return nil
+}
+
 func (ps *parser) parseSettings(value any) (*settings, error) {
 	raw, err := yaml.Marshal(value)
 	if err != nil {
@@ -129,17 +673,102 @@ func (ps *parser) parseSettings(value any) (*settings, error) {
 	// defaults
 	cfg := settings{}
 
-	err = yaml.Unmarshal(raw, &cfg)
-	return &cfg, errors.Wrap(err, "could not parse settings")
+	if err = yaml.Unmarshal(raw, &cfg); err != nil {
+		return nil, errors.Wrap(err, "could not parse settings")
+	}
+
+	cfg.Project, err = projectName(ps.project, cfg.Project)
+	if err != nil {
+		return nil, err
+	}
+	ps.project = cfg.Project
+	ps.logDir = cfg.LogDir
+	ps.rotation = cfg.LogRotation
+	return &cfg, ps.log.redactor.setPatterns(cfg.Redact)
 }
 
-func (ps *parser) parseServices(value any) (map[string]*process, error) {
+func (ps *parser) parseServices(value any) (map[string]*process, map[string]*replicaSet, error) {
 	raw, err := yaml.Marshal(value)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not serialize services")
+		return nil, nil, errors.Wrap(err, "could not serialize services")
+	}
+
+	definitions := make(map[string]*process)
+	err = yaml.Unmarshal(raw, &definitions)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not parse services")
+	}
+
+	nodes := make(map[string]yaml.Node)
+	err = yaml.Unmarshal(raw, &nodes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not parse services")
 	}
 
 	services := make(map[string]*process)
-	err = yaml.Unmarshal(raw, &services)
-	return services, errors.Wrap(err, "could not parse services")
+	sets := make(map[string]*replicaSet)
+	for name, p := range definitions {
+		if err = p.validate(); err != nil {
+			return nil, nil, errors.Wrapf(err, "service %s", name)
+		}
+
+		if p.Replicas == nil {
+			services[name] = p
+			continue
+		}
+
+		set := &replicaSet{
+			name:     name,
+			node:     nodes[name],
+			replicas: *p.Replicas,
+		}
+		for i := 1; i <= set.replicas; i++ {
+			replica, err := set.replica(i)
+			if err != nil {
+				return nil, nil, err
+			}
+			services[replica.Name] = replica
+		}
+		sets[name] = set
+	}
+
+	return services, sets, nil
+}
+
+func (ps *parser) parseTasks(value any) (map[string]*process, error) {
+	raw, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not serialize tasks")
+	}
+
+	tasks := make(map[string]*process)
+	err = yaml.Unmarshal(raw, &tasks)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse tasks")
+	}
+
+	for name, t := range tasks {
+		if err = t.validate(); err != nil {
+			return nil, errors.Wrapf(err, "task %s", name)
+		}
+
+		if t.Replicas != nil {
+			return nil, errors.Errorf("task %s: replicas are not supported by tasks", name)
+		}
+
+		for _, dep := range t.Deps {
+			if _, ok := tasks[dep]; !ok {
+				return nil, errors.Errorf("task %s: unknown dependency %s", name, dep)
+			}
+		}
+
+		t.task = true
+		for _, dep := range t.Deps {
+			t.Hooks.Wait = append(t.Hooks.Wait, &waitCondition{Service: dep}) // A task waits for its dependencies
+		}
+
+		ps.prepare(name, t, tasks)
+	}
+
+	return tasks, nil
 }
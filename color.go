@@ -0,0 +1,179 @@
+package main
+
+import (
+	"hash/fnv"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+// Color modes
+const (
+	colorAlways = "always"
+	colorAuto   = "auto" // when writing to a terminal
+	colorNever  = "never"
+)
+
+// palette is the set of colors assigned to the services, red and yellow are kept for the errors and warnings.
+var palette = []string{"36", "32", "34", "35", "96", "92", "94", "95"}
+
+var namedColors = map[string]string{
+	"black":   "30",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+}
+
+// ansi matches the ANSI escape sequences.
+var ansi = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// parseColor returns the SGR code of a color name (e.g. blue or bright_blue) or of a 256 colors number.
+func parseColor(name string) (string, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < 0 || n > 255 {
+			return "", errors.Errorf("color %d out of range [0-255]", n)
+		}
+		return "38;5;" + name, nil
+	}
+
+	bright, ok := strings.CutPrefix(name, "bright_")
+	if code, found := namedColors[bright]; found {
+		if ok {
+			code = "9" + code[1:]
+		}
+		return code, nil
+	}
+
+	return "", errors.Errorf("unsupported color %s", name)
+}
+
+// colors holds the color settings shared by all the loggers.
+type colors struct {
+	mu       sync.RWMutex
+	mode     string
+	enabled  bool              // colored prefixes
+	strip    bool              // strip the ANSI sequences from the output
+	services map[string]string // SGR codes of the services having their own color
+}
+
+func (c *colors) set(service, code string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.services == nil {
+		c.services = make(map[string]string)
+	}
+	c.services[service] = code
+}
+
+// assign gives the services without their own color a distinct color from the palette, in the order of their names.
+func (c *colors) assign(names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.services == nil {
+		c.services = make(map[string]string)
+	}
+
+	var i int
+	for _, name := range slices.Sorted(slices.Values(names)) {
+		if _, ok := c.services[name]; ok {
+			continue
+		}
+
+		c.services[name] = palette[i%len(palette)]
+		i++
+	}
+}
+
+// alias gives the service the color of another one unless it has its own.
+func (c *colors) alias(name, of string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.services[name]; !ok {
+		c.services[name] = c.services[of]
+	}
+}
+
+// service returns the color of the given service, picked from the palette when not assigned.
+func (c *colors) service(name string, stderr bool) Color {
+	c.mu.RLock()
+	code, ok := c.services[name]
+	c.mu.RUnlock()
+
+	if !ok {
+		h := fnv.New32a()
+		h.Write([]byte(name)) //nolint: errcheck
+		code = palette[h.Sum32()%uint32(len(palette))]
+	}
+
+	if stderr {
+		code = "1;" + code // bold
+	}
+	return Color("\033[" + code + "m")
+}
+
+// setColor enables the colors according to the given mode and the logger output.
+// Unless always enabled, the ANSI sequences are stripped from the output written to files.
+func (l *logger) setColor(mode string) error {
+	switch mode {
+	case "":
+		mode = colorAuto
+	case colorAlways, colorAuto, colorNever:
+	default:
+		return errors.Errorf("unsupported color mode %s", mode)
+	}
+
+	l.colors.mu.Lock()
+	defer l.colors.mu.Unlock()
+
+	l.colors.mode = mode
+	l.colors.enabled = mode == colorAlways || mode == colorAuto && isTerminalWriter(l.w)
+	_, file := l.w.(*rotatingFile)
+	l.colors.strip = mode != colorAlways && file
+	return nil
+}
+
+// setOutput sets the writer of the logger.
+func (l *logger) setOutput(w io.Writer) {
+	l.w = w
+	l.setColor(l.colors.mode) //nolint: errcheck
+}
+
+// colored tells whether the output is colored, never with the JSON log format.
+func (l *logger) colored() bool {
+	l.colors.mu.RLock()
+	defer l.colors.mu.RUnlock()
+
+	return l.colors.enabled && l.format != logFormatJSON
+}
+
+// stripped returns the given line without ANSI sequences when they must be removed from the output.
+// The log files of the services are always stripped unless the colors are always enabled.
+func (l *logger) stripped(line []byte, file bool) []byte {
+	l.colors.mu.RLock()
+	strip := l.colors.strip || file && l.colors.mode != colorAlways
+	l.colors.mu.RUnlock()
+
+	if !strip {
+		return line
+	}
+	return ansi.ReplaceAll(line, nil)
+}
+
+func isTerminalWriter(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// stateDir returns the directory holding the runtime state of the given project.
+func stateDir(project string) string {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("composer-%d", os.Getuid()))
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		dir = filepath.Join(runtime, "composer")
+	}
+	return filepath.Join(dir, project)
+}
+
+func controlSocket(project string) string {
+	return filepath.Join(stateDir(project), "composer.sock")
+}
+
+// serviceState is the state of a service exposed by the control API.
+type serviceState struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Exit   string `json:"exit,omitempty"`
+	Usage  *usage `json:"usage,omitempty"`
+}
+
+// scaleRequest is the body of the scale control API.
+type scaleRequest struct {
+	Service  string `json:"service"`
+	Replicas int    `json:"replicas"`
+}
+
+// serveControl exposes the control API on composer's unix socket until the returned listener is closed.
+func serveControl(runner *processor, project string) (net.Listener, error) {
+	path := controlSocket(project)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close() //nolint: errcheck
+		return nil, errors.Errorf("composer is already running for project %s, use --project-name to run another one", project)
+	}
+	os.Remove(path) //nolint: errcheck // Stale socket
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ps", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runner.reg.states()) //nolint: errcheck
+	})
+	mux.HandleFunc("POST /scale", func(w http.ResponseWriter, r *http.Request) {
+		var req scaleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := runner.scale(req.Service, req.Replicas); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	go http.Serve(listener, mux) //nolint: errcheck
+	return listener, nil
+}
+
+// states returns the state of all the registered processes sorted by name.
+func (r *registry) states() []serviceState {
+	var states []serviceState
+	for _, status := range []string{"ready", "running", "stopped"} {
+		var processes []*process
+		switch status {
+		case "ready":
+			processes = r.readyProcesses()
+		case "running":
+			processes = r.runningProcesses()
+		case "stopped":
+			processes = r.stoppedProcesses()
+		}
+
+		for _, p := range processes {
+			state := serviceState{
+				Name:   p.Name,
+				Status: status,
+				Exit:   r.exitReason(p.Name),
+			}
+			if u := p.currentUsage(); status == "running" && !u.Sampled.IsZero() {
+				state.Usage = &u
+			}
+			states = append(states, state)
+		}
+	}
+
+	slices.SortFunc(states, func(a, b serviceState) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return states
+}
+
+// controlClient returns an HTTP client talking to composer's control API.
+func controlClient(project string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", controlSocket(project))
+			},
+		},
+	}
+}
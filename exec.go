@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+)
+
+const killTimeout = 2 * time.Second
+
+// execHandler runs the external commands like interp.DefaultExecHandler
+// while keeping track of the started processes so they can be signaled.
+func (p *process) execHandler(killTimeout time.Duration) interp.ExecHandlerFunc {
+	return func(ctx context.Context, args []string) error {
+		hc := interp.HandlerCtx(ctx)
+		path, err := interp.LookPathDir(hc.Dir, hc.Env, args[0])
+		if err != nil {
+			fmt.Fprintln(hc.Stderr, err) //nolint: errcheck
+			return interp.NewExitStatus(127)
+		}
+
+		cmd := exec.Cmd{
+			Path:   path,
+			Args:   args,
+			Env:    execEnv(hc.Env),
+			Dir:    hc.Dir,
+			Stdin:  hc.Stdin,
+			Stdout: hc.Stdout,
+			Stderr: hc.Stderr,
+		}
+
+		// A background process group reading the terminal would be stopped (SIGTTIN)
+		if !isTerminal(hc.Stdin) {
+			setProcessGroup(&cmd)
+		}
+
+		p.limit(&cmd)
+
+		err = p.startTracked(&cmd)
+		if err == nil {
+			defer p.untrack(cmd.Process)
+
+			stopf := context.AfterFunc(ctx, func() {
+				p.terminate(cmd.Process, killTimeout)
+			})
+			defer stopf()
+
+			err = cmd.Wait()
+		}
+
+		switch err := err.(type) {
+		case *exec.ExitError:
+			if status, ok := err.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return interp.NewExitStatus(uint8(128 + status.Signal()))
+			}
+			return interp.NewExitStatus(uint8(err.ExitCode()))
+		case *exec.Error:
+			// did not start
+			fmt.Fprintf(hc.Stderr, "%v\n", err) //nolint: errcheck
+			return interp.NewExitStatus(127)
+		default:
+			return err
+		}
+	}
+}
+
+// spawn runs directly the given command in its own process group.
+// The whole group is interrupted then killed when the context is done.
+func (p *process) spawn(ctx context.Context, argv []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	workdir, err := p.workdir()
+	if err != nil {
+		return err
+	}
+
+	environ := p.environ()
+	path, err := interp.LookPathDir(workdir, expand.ListEnviron(environ...), argv[0])
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Cmd{
+		Path:   path,
+		Args:   argv,
+		Env:    environ,
+		Dir:    workdir,
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	}
+	setProcessGroup(&cmd)
+	p.limit(&cmd)
+
+	if err = p.startTracked(&cmd); err != nil {
+		return err
+	}
+	defer p.untrack(cmd.Process)
+
+	stopf := context.AfterFunc(ctx, func() {
+		p.terminate(cmd.Process, killTimeout)
+	})
+	defer stopf()
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// spawning is held while a command is started and tracked,
+// so the orphans reaper never mistakes a command just started for an orphan.
+var spawning sync.RWMutex
+
+// startTracked starts the command and tracks it until untracked.
+func (p *process) startTracked(cmd *exec.Cmd) error {
+	spawning.RLock()
+	defer spawning.RUnlock()
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.track(cmd.Process)
+	return nil
+}
+
+func (p *process) track(process *os.Process) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.children == nil {
+		p.children = make(map[*os.Process]struct{})
+		p.groups = make(map[*os.Process]struct{})
+	}
+	p.children[process] = struct{}{}
+	p.groups[process] = struct{}{}
+}
+
+func (p *process) untrack(process *os.Process) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.children, process)
+
+	// The ids of the empty groups can be reused by unrelated processes
+	for group := range p.groups {
+		if _, running := p.children[group]; !running && !groupExists(group) {
+			delete(p.groups, group)
+		}
+	}
+}
+
+// signal sends the given signal to all the running commands of the process.
+func (p *process) signal(sig os.Signal) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for child := range p.children {
+		signalGroup(child, sig) //nolint: errcheck
+	}
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// execEnv returns the exported variables of the shell environment.
+func execEnv(env expand.Environ) []string {
+	list := make([]string, 0, 64)
+	for name, vr := range env.Each {
+		if !vr.IsSet() {
+			// Unset in the runner, make sure it is not inherited
+			for i, kv := range list {
+				if strings.HasPrefix(kv, name+"=") {
+					list[i] = ""
+				}
+			}
+		}
+		if vr.Exported && vr.Kind == expand.String {
+			list = append(list, name+"="+vr.String())
+		}
+	}
+	return list
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command the leader of a new process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalGroup sends the signal to the process group led by the given process,
+// or to the process alone when it does not lead a group.
+// The group is still signaled once its leader has exited.
+func signalGroup(process *os.Process, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return process.Signal(sig)
+	}
+
+	if err := syscall.Kill(-process.Pid, s); err != syscall.ESRCH {
+		return err
+	}
+	return process.Signal(sig)
+}
+
+// groupExists tells whether the process group led by the given process still has members, zombies included.
+func groupExists(process *os.Process) bool {
+	return syscall.Kill(-process.Pid, 0) == nil
+}
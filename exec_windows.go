@@ -0,0 +1,27 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command the root of a new process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// signalGroup sends the signal to the given process, Windows has no process group signaling.
+func signalGroup(process *os.Process, sig os.Signal) error {
+	return process.Signal(sig)
+}
+
+// groupExists always returns false, only the processes themselves are signaled on Windows.
+func groupExists(_ *os.Process) bool {
+	return false
+}
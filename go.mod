@@ -3,9 +3,12 @@ module github.com/mdouchement/composer
 go 1.24
 
 require (
+	github.com/creack/pty v1.1.24
 	github.com/mdouchement/upathex v0.1.0
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/cobra v1.9.1
+	golang.org/x/sys v0.33.0
+	golang.org/x/term v0.32.0
 	gopkg.in/yaml.v3 v3.0.1
 	mvdan.cc/sh/v3 v3.11.0
 )
@@ -14,6 +17,4 @@ require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
-	golang.org/x/sys v0.33.0 // indirect
-	golang.org/x/term v0.32.0 // indirect
 )
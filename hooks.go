@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+const defaultHookTimeout = 30 * time.Second
+
+type hooks struct {
+	Wait      []*waitCondition `yaml:"wait"`
+	Kill      []string         `yaml:"kill"`
+	PreStart  *hook            `yaml:"pre_start"`
+	PostStart *hook            `yaml:"post_start"`
+	PreStop   *hook            `yaml:"pre_stop"`
+	PostStop  *hook            `yaml:"post_stop"`
+}
+
+// A hook is a shell command run at a given step of the process lifecycle.
+// It is defined either as a plain command or as a map with its own timeout.
+type hook struct {
+	Command string        `yaml:"command"`
+	Timeout time.Duration `yaml:"timeout"`
+	Ready   string        `yaml:"ready"` // post_start only, log pattern telling the service is ready
+
+	ready *regexp.Regexp
+}
+
+func (h *hook) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&h.Command)
+	}
+
+	type plain hook
+	if err := value.Decode((*plain)(h)); err != nil {
+		return err
+	}
+
+	if h.Ready != "" {
+		var err error
+		h.ready, err = regexp.Compile(h.Ready)
+		if err != nil {
+			return errors.Wrapf(err, "line %d: invalid hook ready pattern", value.Line)
+		}
+	}
+
+	return nil
+}
+
+// ready returns a channel closed once the process is ready, when it logs a line matching the ready pattern of its post_start hook
+// or, without ready pattern, all the log patterns awaited by the other services.
+// The channel is closed right away when there is no pattern.
+func (p *process) ready() <-chan struct{} {
+	ready := make(chan struct{})
+
+	p.mu.Lock()
+	patterns := p.readyPatterns
+	p.mu.Unlock()
+	if p.Hooks.PostStart != nil && p.Hooks.PostStart.ready != nil {
+		patterns = []*regexp.Regexp{p.Hooks.PostStart.ready}
+	}
+	if len(patterns) == 0 {
+		close(ready)
+		return ready
+	}
+
+	var remaining atomic.Int32
+	remaining.Store(int32(len(patterns)))
+	for _, pattern := range patterns {
+		p.watchLog(pattern, func() {
+			if remaining.Add(-1) == 0 {
+				close(ready)
+			}
+		})
+	}
+
+	return ready
+}
+
+// runHook runs the given hook with the same shell environment as the process.
+func (p *process) runHook(ctx context.Context, name string, h *hook) error {
+	if h == nil {
+		return nil
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	log := p.Logger.WithPrefixName(p.PaddedName).WithPrefixName(name)
+	logout := log.Stdout()
+	logerr := log.Stderr()
+	defer logout.Close()
+	defer logerr.Close()
+
+	command, err := syntax.NewParser().Parse(strings.NewReader(h.Command), "")
+	if err != nil {
+		return errors.Wrapf(err, "%s hook", name)
+	}
+
+	shell, err := p.shell(nil, logout, logerr)
+	if err != nil {
+		return errors.Wrapf(err, "%s hook", name)
+	}
+
+	err = shell.Run(ctx, command)
+	if ctx.Err() == context.DeadlineExceeded {
+		err = errors.Errorf("timed out after %s", timeout)
+	}
+
+	return errors.Wrapf(err, "%s hook", name)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+const defaultLogTemplate = "{{.level}} {{.msg}}"
+
+// The common names of the level, message and time fields, normalized as level, msg and time.
+var jsonLineAliases = map[string][]string{
+	"level": {"level", "lvl", "severity"},
+	"msg":   {"msg", "message"},
+	"time":  {"time", "ts", "timestamp", "@timestamp"},
+}
+
+// A jsonLines renders the JSON lines of a service in a compact form.
+// The fields not used by the template are appended as key=value.
+type jsonLines struct {
+	template *template.Template
+	used     map[string]bool // fields used by the template, with their aliases
+}
+
+func newJSONLines(text string) (*jsonLines, error) {
+	if text == "" {
+		text = defaultLogTemplate
+	}
+
+	tmpl, err := template.New("log_template").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid log_template")
+	}
+
+	j := &jsonLines{
+		template: tmpl,
+		used:     make(map[string]bool),
+	}
+	templateFields(tmpl.Root, j.used)
+
+	// The time is printed by composer with --timestamps
+	j.used["time"] = true
+
+	for name, aliases := range jsonLineAliases {
+		if j.used[name] {
+			for _, alias := range aliases {
+				j.used[alias] = true
+			}
+		}
+	}
+
+	return j, nil
+}
+
+// templateFields collects the top-level fields referenced by the template nodes.
+func templateFields(node parse.Node, fields map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, node := range n.Nodes {
+			templateFields(node, fields)
+		}
+	case *parse.ActionNode:
+		templateFields(n.Pipe, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			templateFields(cmd, fields)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			templateFields(arg, fields)
+		}
+	case *parse.IfNode:
+		templateFields(&n.BranchNode, fields)
+	case *parse.RangeNode:
+		templateFields(&n.BranchNode, fields)
+	case *parse.WithNode:
+		templateFields(&n.BranchNode, fields)
+	case *parse.BranchNode:
+		templateFields(n.Pipe, fields)
+		templateFields(n.List, fields)
+		templateFields(n.ElseList, fields)
+	case *parse.FieldNode:
+		fields[n.Ident[0]] = true
+	}
+}
+
+// render returns the compact form of a JSON line, false when the line is not a JSON object.
+func (j *jsonLines) render(line []byte, colored bool) ([]byte, bool) {
+	keys, values, ok := parseJSONLine(line)
+	if !ok {
+		return line, false
+	}
+
+	fields := make(map[string]any, len(values)+len(jsonLineAliases))
+	for k, v := range values {
+		var value any
+		d := json.NewDecoder(bytes.NewReader(v))
+		d.UseNumber()
+		d.Decode(&value) //nolint: errcheck
+		fields[k] = value
+	}
+
+	// Missing fields would be printed as <no value>
+	for name, aliases := range jsonLineAliases {
+		var value any = ""
+		for _, alias := range aliases {
+			if v, ok := fields[alias]; ok && v != "" {
+				value = v
+				break
+			}
+		}
+		fields[name] = value
+	}
+
+	if lvl, ok := fields["level"].(string); ok && lvl != "" && colored {
+		fields["level"] = string(levelColor(lvl)) + lvl + string(Reset)
+	}
+
+	var buf bytes.Buffer
+	if err := j.template.Execute(&buf, fields); err != nil {
+		return line, false
+	}
+
+	for _, k := range keys {
+		if j.used[k] {
+			continue
+		}
+
+		buf.WriteByte(' ') //nolint: errcheck
+		if colored {
+			buf.WriteString(string(Faint) + k + "=" + string(Reset)) //nolint: errcheck
+		} else {
+			buf.WriteString(k + "=") //nolint: errcheck
+		}
+		buf.Write(fieldValue(values[k])) //nolint: errcheck
+	}
+
+	return bytes.TrimSpace(buf.Bytes()), true
+}
+
+// parseJSONLine returns the fields of a JSON object in their order of appearance.
+func parseJSONLine(line []byte) ([]string, map[string]json.RawMessage, bool) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte("{")) || !json.Valid(line) {
+		return nil, nil, false
+	}
+
+	d := json.NewDecoder(bytes.NewReader(line))
+	d.Token() //nolint: errcheck // {
+
+	var keys []string
+	values := make(map[string]json.RawMessage)
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return nil, nil, false
+		}
+		key := t.(string)
+
+		var value json.RawMessage
+		if err = d.Decode(&value); err != nil {
+			return nil, nil, false
+		}
+
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+
+	return keys, values, true
+}
+
+// fieldValue returns the value of an extra field, the strings are quoted only when needed.
+func fieldValue(raw json.RawMessage) []byte {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		var buf bytes.Buffer
+		json.Compact(&buf, raw) //nolint: errcheck
+		return buf.Bytes()
+	}
+
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") || strconv.Quote(s) != `"`+s+`"` {
+		return []byte(strconv.Quote(s))
+	}
+	return []byte(s)
+}
+
+// levelColor returns the color of the given level name.
+func levelColor(name string) Color {
+	lvl, _ := parseLevel(name)
+	switch {
+	case lvl >= levelError:
+		return Red
+	case lvl == levelWarn:
+		return Yellow
+	case lvl == levelInfo:
+		return Cyan
+	default:
+		return Faint
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// A level is the severity of a log line.
+type level int
+
+const (
+	levelUnknown level = iota
+	levelTrace
+	levelDebug
+	levelInfo
+	levelWarn
+	levelError
+	levelFatal
+)
+
+var levelNames = map[string]level{
+	"trace":     levelTrace,
+	"debug":     levelDebug,
+	"info":      levelInfo,
+	"notice":    levelInfo,
+	"warn":      levelWarn,
+	"warning":   levelWarn,
+	"error":     levelError,
+	"err":       levelError,
+	"fatal":     levelFatal,
+	"critical":  levelFatal,
+	"crit":      levelFatal,
+	"panic":     levelFatal,
+	"emergency": levelFatal,
+	"alert":     levelFatal,
+}
+
+// Rails/Ruby Logger severity letters, e.g. `E, [2024-05-02T10:04:05.123 #123] ERROR -- : message`.
+var levelLetters = map[byte]level{
+	'D': levelDebug,
+	'I': levelInfo,
+	'W': levelWarn,
+	'E': levelError,
+	'F': levelFatal,
+}
+
+var (
+	// {"level":"info",...}
+	jsonLevel = regexp.MustCompile(`"(?:level|lvl|severity)"\s*:\s*"(\w+)"`)
+	// level=info or lvl="info"
+	logfmtLevel = regexp.MustCompile(`\b(?:level|lvl|severity)="?(\w+)`)
+	// [INFO], INFO:, 2024/05/02 10:04:05 ERROR message, etc.
+	wordLevel = regexp.MustCompile(`^(?:\S+\s+){0,3}?\[?(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|ERR|FATAL|CRITICAL|CRIT|PANIC)\]?(?:[\s:]|$)`)
+	// Ruby Logger
+	rubyLevel = regexp.MustCompile(`^([DIWEF]), \[`)
+)
+
+func parseLevel(name string) (level, error) {
+	if l, ok := levelNames[strings.ToLower(name)]; ok {
+		return l, nil
+	}
+	return levelUnknown, errors.Errorf("unsupported log level %s", name)
+}
+
+func (l level) String() string {
+	switch l {
+	case levelTrace:
+		return "trace"
+	case levelDebug:
+		return "debug"
+	case levelInfo:
+		return "info"
+	case levelWarn:
+		return "warn"
+	case levelError:
+		return "error"
+	case levelFatal:
+		return "fatal"
+	default:
+		return ""
+	}
+}
+
+// detectLevel infers the level of a line from the common log formats.
+func detectLevel(line []byte) level {
+	if bytes.IndexByte(line, '\x1b') >= 0 {
+		line = ansi.ReplaceAll(line, nil)
+	}
+
+	var m [][]byte
+	switch {
+	case bytes.HasPrefix(bytes.TrimSpace(line), []byte("{")):
+		m = jsonLevel.FindSubmatch(line)
+	case logfmtLevel.Match(line):
+		m = logfmtLevel.FindSubmatch(line)
+	case rubyLevel.Match(line):
+		return levelLetters[line[0]]
+	default:
+		m = wordLevel.FindSubmatch(line)
+	}
+
+	if m == nil {
+		return levelUnknown
+	}
+
+	return levelNames[strings.ToLower(string(m[1]))]
+}
+
+// levels holds the minimum levels of the lines to print, shared by all the loggers.
+// The lines without detected level are always printed.
+type levels struct {
+	mu       sync.RWMutex
+	min      level
+	services map[string]level
+}
+
+func (ls *levels) set(service string, l level) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.services == nil {
+		ls.services = make(map[string]level)
+	}
+	ls.services[service] = l
+}
+
+// setLevel hides the lines below the given level, none when empty.
+func (l *logger) setLevel(name string) error {
+	min := levelUnknown
+	if name != "" {
+		var err error
+		if min, err = parseLevel(name); err != nil {
+			return err
+		}
+	}
+
+	l.levels.mu.Lock()
+	defer l.levels.mu.Unlock()
+
+	l.levels.min = min
+	return nil
+}
+
+// hidden tells whether a line of the given level must not be printed.
+func (l *logger) hidden(lvl level) bool {
+	if lvl == levelUnknown {
+		return false
+	}
+
+	l.levels.mu.RLock()
+	defer l.levels.mu.RUnlock()
+
+	min := l.levels.min
+	if len(l.names) != 0 {
+		if service, ok := l.levels.services[l.names[0]]; ok {
+			min = service
+		}
+	}
+	return lvl < min
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// errOOMKilled is returned when the process has been killed by the OOM killer.
+var errOOMKilled = errors.New("killed by the OOM killer")
+
+// limits are the resource limits applied to all the commands of a process.
+type limits struct {
+	NoFile *uint64   `yaml:"nofile"` // max open files
+	NProc  *uint64   `yaml:"nproc"`  // max processes
+	Core   *byteSize `yaml:"core"`   // max core dump size
+	Memory byteSize  `yaml:"memory"` // cgroup v2 memory.max
+	CPU    float64   `yaml:"cpu"`    // cgroup v2 cpu.max, in number of CPUs
+}
+
+func (l *limits) cgroup() bool {
+	return l != nil && (l.Memory != 0 || l.CPU != 0)
+}
+
+// rlimits returns the rlimits by name, as used by the limit command.
+func (l *limits) rlimits() map[string]uint64 {
+	rlimits := make(map[string]uint64)
+	if l == nil {
+		return rlimits
+	}
+
+	if l.NoFile != nil {
+		rlimits["nofile"] = *l.NoFile
+	}
+	if l.NProc != nil {
+		rlimits["nproc"] = *l.NProc
+	}
+	if l.Core != nil {
+		rlimits["core"] = uint64(*l.Core)
+	}
+	return rlimits
+}
+
+// limit configures the command to be run with the process's limits.
+// The rlimits are set by the limit command of composer before executing the actual command,
+// so they are applied before the command starts.
+func (p *process) limit(cmd *exec.Cmd) {
+	p.limitCgroup(cmd)
+
+	rlimits := p.Limits.rlimits()
+	if len(rlimits) == 0 {
+		return
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		names := slices.Sorted(maps.Keys(rlimits))
+		p.Logger.WithPrefixName(p.PaddedName).Warn(fmt.Sprintf("%s limits not applied: %s", strings.Join(names, ", "), err))
+		return
+	}
+
+	args := []string{self, "limit"}
+	for name, value := range rlimits {
+		args = append(args, fmt.Sprintf("--%s=%d", name, value))
+	}
+	args = append(args, "--", cmd.Path)
+
+	cmd.Args = append(args, cmd.Args...)
+	cmd.Path = self
+}
+
+// A byteSize is a number of bytes defined like 512, 64K, 256M, 2G or unlimited.
+type byteSize uint64
+
+func (b *byteSize) UnmarshalYAML(value *yaml.Node) error {
+	var raw string
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	size, err := parseByteSize(raw)
+	if err != nil {
+		return errors.Wrapf(err, "line %d", value.Line)
+	}
+
+	*b = size
+	return nil
+}
+
+func parseByteSize(raw string) (byteSize, error) {
+	raw = strings.ToUpper(strings.TrimSpace(raw))
+	if raw == "UNLIMITED" {
+		return math.MaxUint64, nil
+	}
+
+	unit := uint64(1)
+	raw = strings.TrimSuffix(raw, "B")
+	if raw != "" {
+		if i := strings.Index("KMGT", raw[len(raw)-1:]); i >= 0 {
+			unit = 1 << (10 * (i + 1))
+			raw = raw[:len(raw)-1]
+		}
+	}
+
+	n, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid size %s", raw)
+	}
+	return byteSize(n * unit), nil
+}
+
+// A cgroup is the cgroup v2 dedicated to a process's run.
+type cgroup struct {
+	path  string
+	fd    int
+	ooms  uint64 // OOM kills before the run
+	limit byteSize
+}
@@ -0,0 +1,183 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const cpuPeriod = 100000 // µs
+
+var delegated struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// delegatedCgroup returns the cgroup v2 of composer, ready to host the services' cgroups.
+// Composer moves itself to a leaf cgroup since a cgroup with enabled controllers cannot contain processes.
+func delegatedCgroup() (string, error) {
+	delegated.once.Do(func() {
+		mountpoint, err := cgroup2Mountpoint()
+		if err != nil {
+			delegated.err = err
+			return
+		}
+
+		data, err := os.ReadFile("/proc/self/cgroup")
+		if err != nil {
+			delegated.err = err
+			return
+		}
+
+		var own string
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "0::") {
+				own = filepath.Join(mountpoint, strings.TrimPrefix(line, "0::"))
+			}
+		}
+		if own == "" {
+			delegated.err = errors.New("composer is not in a cgroup v2")
+			return
+		}
+
+		leaf := filepath.Join(own, "composer")
+		if err = os.Mkdir(leaf, 0o755); err != nil && !os.IsExist(err) {
+			delegated.err = errors.Wrap(err, "cgroup is not delegated")
+			return
+		}
+
+		if err = os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+			delegated.err = errors.Wrap(err, "cgroup is not delegated")
+			return
+		}
+
+		if err = os.WriteFile(filepath.Join(own, "cgroup.subtree_control"), []byte("+memory +cpu"), 0o644); err != nil {
+			delegated.err = errors.Wrap(err, "could not enable memory and cpu controllers")
+
+			// Rollback
+			os.WriteFile(filepath.Join(own, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0o644) //nolint: errcheck
+			os.Remove(leaf)                                                                            //nolint: errcheck
+			return
+		}
+
+		delegated.path = own
+	})
+
+	return delegated.path, delegated.err
+}
+
+func cgroup2Mountpoint() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// 36 35 0:32 / /sys/fs/cgroup rw,nosuid - cgroup2 cgroup2 rw
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" {
+				return fields[4], nil
+			}
+		}
+	}
+
+	return "", errors.New("cgroup v2 is not mounted")
+}
+
+// newCgroup creates the cgroup of the process with its limits.
+func (p *process) newCgroup() (*cgroup, error) {
+	parent, err := delegatedCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	cg := &cgroup{
+		// The composers sharing the delegated cgroup may run services with the same names
+		path:  filepath.Join(parent, fmt.Sprintf("svc.%s.%d.%s", p.Environment["COMPOSER_PROJECT"], os.Getpid(), p.Name)),
+		limit: p.Limits.Memory,
+	}
+
+	if err = os.Mkdir(cg.path, 0o755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	if p.Limits.Memory != 0 {
+		if err = os.WriteFile(filepath.Join(cg.path, "memory.max"), []byte(strconv.FormatUint(uint64(p.Limits.Memory), 10)), 0o644); err != nil {
+			return nil, errors.Wrap(err, "could not set memory.max")
+		}
+		cg.ooms = cg.oomKills()
+	}
+
+	if p.Limits.CPU != 0 {
+		quota := fmt.Sprintf("%d %d", int(p.Limits.CPU*cpuPeriod), cpuPeriod)
+		if err = os.WriteFile(filepath.Join(cg.path, "cpu.max"), []byte(quota), 0o644); err != nil {
+			return nil, errors.Wrap(err, "could not set cpu.max")
+		}
+	}
+
+	cg.fd, err = unix.Open(cg.path, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return cg, nil
+}
+
+// oomKilled tells whether a process has been killed by the OOM killer since the cgroup creation.
+func (cg *cgroup) oomKilled() bool {
+	return cg.oomKills() > cg.ooms
+}
+
+func (cg *cgroup) oomKills() uint64 {
+	data, err := os.ReadFile(filepath.Join(cg.path, "memory.events"))
+	if err != nil {
+		return 0
+	}
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if v, ok := bytes.CutPrefix(line, []byte("oom_kill ")); ok {
+			n, _ := strconv.ParseUint(string(v), 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// remove deletes the cgroup, it fails silently when processes are still in there.
+func (cg *cgroup) remove() {
+	unix.Close(cg.fd)  //nolint: errcheck
+	os.Remove(cg.path) //nolint: errcheck
+}
+
+// limitCgroup configures the command to be started in the process's cgroup.
+func (p *process) limitCgroup(cmd *exec.Cmd) {
+	p.mu.Lock()
+	cg := p.cgroup
+	p.mu.Unlock()
+
+	if cg == nil {
+		return
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = cg.fd
+}
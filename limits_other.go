@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+func (p *process) newCgroup() (*cgroup, error) {
+	return nil, errors.New("cgroups are only supported on Linux")
+}
+
+func (cg *cgroup) oomKilled() bool {
+	return false
+}
+
+func (cg *cgroup) remove() {}
+
+func (p *process) limitCgroup(_ *exec.Cmd) {}
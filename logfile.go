@@ -0,0 +1,213 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// logRotation defines when the log files are rotated and how many rotated files are kept.
+type logRotation struct {
+	MaxSize  byteSize      `yaml:"max_size"`  // no size limit when zero
+	MaxAge   time.Duration `yaml:"max_age"`   // no age limit when zero
+	MaxFiles int           `yaml:"max_files"` // all the rotated files are kept when zero
+	Compress bool          `yaml:"compress"`  // gzip the rotated files
+}
+
+// A rotatingFile is a log file rotated according to the given rotation.
+// It is created on the first write.
+type rotatingFile struct {
+	path     string
+	rotation logRotation
+
+	mu          sync.Mutex
+	file        *os.File
+	size        int64
+	opened      time.Time
+	compressing sync.WaitGroup
+	maintenance sync.Mutex // one rotated file is compressed and pruned at a time
+}
+
+func newRotatingFile(path string, rotation logRotation) *rotatingFile {
+	return &rotatingFile{
+		path:     path,
+		rotation: rotation,
+	}
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil && f.expired(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the file and waits for the rotated files to be compressed.
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+
+	f.compressing.Wait()
+	return err
+}
+
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := openLogFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close() //nolint: errcheck
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// expired tells whether the file must be rotated before writing n bytes.
+func (f *rotatingFile) expired(n int) bool {
+	if f.rotation.MaxSize > 0 && f.size > 0 && f.size+int64(n) > int64(f.rotation.MaxSize) {
+		return true
+	}
+	return f.rotation.MaxAge > 0 && time.Since(f.opened) > f.rotation.MaxAge
+}
+
+// rotate renames the current file with a timestamp suffix, then compresses it and prunes the old files.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	rotated := f.path + "." + time.Now().Format("20060102-150405.000000")
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+
+	f.compressing.Add(1)
+	go func() {
+		defer f.compressing.Done()
+
+		f.maintenance.Lock()
+		defer f.maintenance.Unlock()
+
+		if f.rotation.Compress {
+			compress(rotated) //nolint: errcheck
+		}
+		f.prune()
+	}()
+
+	return nil
+}
+
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	w := gzip.NewWriter(dst)
+	if _, err = io.Copy(w, src); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// prune removes the oldest rotated files beyond the maximum number of files.
+func (f *rotatingFile) prune() {
+	if f.rotation.MaxFiles <= 0 {
+		return
+	}
+
+	rotated, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+
+	slices.Sort(rotated) // The timestamp suffixes are sorted chronologically
+
+	for len(rotated) > f.rotation.MaxFiles {
+		os.Remove(rotated[0]) //nolint: errcheck
+		rotated = rotated[1:]
+	}
+}
+
+// logFiles holds the log files of the services.
+type logFiles struct {
+	mu    sync.RWMutex
+	files map[string]*rotatingFile
+}
+
+func (l *logFiles) set(name string, f *rotatingFile) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.files == nil {
+		l.files = make(map[string]*rotatingFile)
+	}
+	l.files[name] = f
+}
+
+func (l *logFiles) get(name string) io.Writer {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if f, ok := l.files[name]; ok {
+		return f
+	}
+	return nil
+}
+
+func (l *logFiles) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, f := range l.files {
+		f.Close() //nolint: errcheck
+	}
+	return nil
+}
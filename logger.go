@@ -3,10 +3,17 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"regexp"
 	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // ANSI color
@@ -17,6 +24,7 @@ const (
 	Red    Color = "\033[31m"
 	Yellow Color = "\033[33m"
 	Cyan   Color = "\033[36m"
+	Faint  Color = "\033[2m"
 )
 
 // ----------------
@@ -25,62 +33,184 @@ const (
 // -----
 // ---
 
+// Log formats
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
 type logger struct {
-	w      io.Writer
-	prefix string
+	w        io.Writer
+	prefix   string
+	names    []string
+	format   string
+	clock    *clock    // prepends timestamps when set
+	files    *logFiles // services log files, written along w
+	colors   *colors
+	levels   *levels
+	redactor *redactor
+	sinks    *sinks // syslog, journald, etc.
+}
+
+// setFormat sets the output format of the logger, text when empty.
+func (l *logger) setFormat(format string) error {
+	switch format {
+	case "":
+		format = logFormatText
+	case logFormatText, logFormatJSON:
+	default:
+		return errors.Errorf("unsupported log format %s", format)
+	}
+
+	l.format = format
+	return nil
+}
+
+// setTimestamps prepends the timestamps in the given format to the text lines, none when empty or false.
+func (l *logger) setTimestamps(format string) error {
+	if format == "" || format == "false" {
+		l.clock = nil
+		return nil
+	}
+
+	var err error
+	l.clock, err = newClock(format)
+	return err
 }
 
 func (l *logger) WithPrefixName(name string) *logger {
+	names := append(l.names[:len(l.names):len(l.names)], strings.TrimSpace(name))
+
 	name += ": " // space important
 	if l.prefix != "" {
 		name = l.prefix + name
 	}
 
 	return &logger{
-		w:      l.w,
-		prefix: name,
+		w:        l.w,
+		prefix:   name,
+		names:    names,
+		format:   l.format,
+		clock:    l.clock,
+		files:    l.files,
+		colors:   l.colors,
+		levels:   l.levels,
+		redactor: l.redactor,
+		sinks:    l.sinks,
 	}
 }
 
 func (l *logger) Info(args ...any) {
-	l.println(Cyan, args...)
+	l.println(Cyan, levelInfo, args...)
 }
 
 func (l *logger) Warn(args ...any) {
-	l.println(Yellow, args...)
+	l.println(Yellow, levelWarn, args...)
 }
 
 func (l *logger) Error(args ...any) {
-	l.println(Red, args...)
+	l.println(Red, levelError, args...)
 }
 
-func (l *logger) println(c Color, args ...any) {
-	buf := bytes.NewBuffer(make([]byte, len(l.prefix)+len(args)))
+func (l *logger) println(c Color, lvl level, args ...any) {
+	if l.hidden(lvl) {
+		return
+	}
+
+	msg := l.redactor.redact([]byte(fmt.Sprint(args...)))
+	l.sink("composer", lvl, msg)
+
+	if l.format == logFormatJSON {
+		l.w.Write(l.record("composer", lvl.String(), l.stripped(msg, false))) //nolint: errcheck
+		if f := l.file(); f != nil {
+			f.Write(l.record("composer", lvl.String(), l.stripped(msg, true))) //nolint: errcheck
+		}
+		return
+	}
+
+	var stamp string
+	if l.clock != nil {
+		stamp = l.clock.stamp() + " "
+	}
+
+	if f := l.file(); f != nil {
+		io.WriteString(f, stamp+string(l.stripped(msg, true))+"\n") //nolint: errcheck
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString(stamp) //nolint: errcheck
 
 	if l.prefix != "" {
-		fmt.Fprintf(buf, "%s%s%s", c, l.prefix, Reset) //nolint: errcheck
+		if l.colored() {
+			fmt.Fprintf(&buf, "%s%s%s", c, l.prefix, Reset) //nolint: errcheck
+		} else {
+			buf.WriteString(l.prefix) //nolint: errcheck
+		}
 	}
 
-	fmt.Fprint(buf, args...) //nolint: errcheck
-	buf.WriteString("\n")    //nolint: errcheck
+	buf.Write(l.stripped(msg, false)) //nolint: errcheck
+	buf.WriteString("\n")             //nolint: errcheck
 
 	buf.WriteTo(l.w) //nolint: errcheck
 }
 
+// file returns the log file of the service the logger is for, nil if none.
+func (l *logger) file() io.Writer {
+	if l.files == nil || len(l.names) == 0 {
+		return nil
+	}
+	return l.files.get(l.names[0])
+}
+
+// A logRecord is a log line in the JSON format.
+type logRecord struct {
+	Time    time.Time `json:"time"`
+	Service string    `json:"service,omitempty"`
+	Scope   string    `json:"scope,omitempty"` // e.g. the hook name
+	Stream  string    `json:"stream"`          // stdout, stderr or composer
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// record returns the given message as a JSON line.
+func (l *logger) record(stream, level string, msg []byte) []byte {
+	r := logRecord{
+		Time:    time.Now(),
+		Stream:  stream,
+		Level:   level,
+		Message: string(ansi.ReplaceAll(msg, nil)), // the colors have no meaning in JSON
+	}
+	if len(l.names) != 0 {
+		r.Service = l.names[0]
+		r.Scope = strings.Join(l.names[1:], ": ")
+	}
+
+	line, _ := json.Marshal(r) // Cannot fail
+	return append(line, '\n')
+}
+
 func (l *logger) Stdout() *std {
-	return l.writer(Cyan)
+	return l.writer("stdout", "info")
 }
 
 func (l *logger) Stderr() *std {
-	return l.writer(Yellow)
+	return l.writer("stderr", "error")
 }
 
-func (l *logger) writer(c Color) *std {
+func (l *logger) writer(stream, level string) *std {
 	var prefix []byte
-	if l.prefix != "" {
+	switch {
+	case l.prefix != "" && l.colored():
+		c := l.colors.service(l.names[0], stream == "stderr")
 		prefix = fmt.Appendf(nil, "%s%s%s", c, l.prefix, Reset)
+	case l.prefix != "":
+		prefix = []byte(l.prefix)
 	}
 	s := newStd(l.w, prefix)
+	s.log = l
+	s.stream = stream
+	s.level = level
 
 	return s
 }
@@ -90,9 +220,21 @@ func (l *logger) writer(c Color) *std {
 
 type std struct {
 	io.Writer
-	prefix []byte
-	w      io.Writer
-	trim   *regexp.Regexp
+	prefix  []byte
+	w       io.Writer
+	trim    *regexp.Regexp
+	rules   []*logRule
+	json    *jsonLines // renders the JSON lines when set
+	observe func(line []byte)
+	done    chan struct{}
+	log     *logger
+	stream  string
+	level   string
+
+	multiline  *multiline // groups the lines of the records when set
+	blockMu    sync.Mutex
+	block      [][]byte
+	flushTimer *time.Timer
 }
 
 func newStd(w io.Writer, prefix []byte) *std {
@@ -102,6 +244,7 @@ func newStd(w io.Writer, prefix []byte) *std {
 		Writer: writer,
 		w:      w,
 		prefix: prefix,
+		done:   make(chan struct{}),
 	}
 
 	// Start a new goroutine to scan the input and write it to the logger using the specified print function.
@@ -155,13 +298,29 @@ func (s *std) writerScanner(reader *io.PipeReader) {
 	// Scan the input and write it to the logger using the specified print function
 	for scanner.Scan() {
 		p := bytes.TrimRight(scanner.Bytes(), "\r\n")
-		p = s.extractMessage(p)
-		if len(s.prefix) != 0 {
-			p = append(s.prefix, p...)
+		if s.observe != nil {
+			s.observe(p)
+
+			if setOutput.Match(p) {
+				continue // the outputs are not printed
+			}
+		}
+
+		if s.multiline != nil {
+			s.group(bytes.Clone(p))
+			continue
 		}
-		p = append(p, '\n')
 
-		s.w.Write(p) //nolint: errcheck
+		s.print([][]byte{p})
+	}
+
+	if s.multiline != nil {
+		s.blockMu.Lock()
+		if s.flushTimer != nil {
+			s.flushTimer.Stop()
+		}
+		s.flush()
+		s.blockMu.Unlock()
 	}
 
 	// If there was an error while scanning the input, log an error
@@ -171,6 +330,89 @@ func (s *std) writerScanner(reader *io.PipeReader) {
 
 	// Close the reader when we are done
 	reader.Close() //nolint: errcheck
+	close(s.done)
+}
+
+// print writes the lines of a record as one block, the level of the record is the one of its first line.
+func (s *std) print(lines [][]byte) {
+	for i, p := range lines {
+		lines[i] = s.log.redactor.redact(p)
+	}
+
+	lvl := detectLevel(lines[0])
+	if s.log.hidden(lvl) {
+		return
+	}
+
+	var rendered bool
+	msgs := make([][]byte, 0, len(lines))
+	for i, p := range lines {
+		if s.json != nil {
+			var ok bool
+			p, ok = s.json.render(p, s.log.colored())
+			rendered = rendered || ok
+		}
+
+		p = s.extractMessage(p)
+
+		var keep bool
+		if p, keep = applyLogRules(s.rules, p, s.log.colored()); !keep {
+			if i == 0 {
+				return // the whole record is dropped
+			}
+			continue
+		}
+		msgs = append(msgs, p)
+	}
+
+	s.log.sink(s.stream, lvl, bytes.Join(msgs, []byte{'\n'}))
+
+	file := s.log.file()
+
+	if s.log.format == logFormatJSON {
+		level := s.level
+		if lvl != levelUnknown {
+			level = lvl.String()
+		}
+
+		msg := bytes.Join(msgs, []byte{'\n'})
+		s.w.Write(s.log.record(s.stream, level, s.log.stripped(msg, false))) //nolint: errcheck
+		if file != nil {
+			file.Write(s.log.record(s.stream, level, s.log.stripped(msg, true))) //nolint: errcheck
+		}
+		return
+	}
+
+	var stamp []byte
+	if s.log.clock != nil {
+		stamp = []byte(s.log.clock.stamp() + " ")
+	}
+
+	var out, tee bytes.Buffer
+	for _, p := range msgs {
+		if file != nil {
+			tee.Write(slices.Concat(stamp, s.log.stripped(p, true), []byte{'\n'})) //nolint: errcheck
+		}
+
+		msg := s.log.stripped(p, false)
+		if lvl >= levelError && s.log.colored() && !rendered { // the rendered level is already colored
+			msg = slices.Concat([]byte(Red), msg, []byte(Reset)) // highlight
+		}
+
+		out.Write(slices.Concat(stamp, s.prefix, msg, []byte{'\n'})) //nolint: errcheck
+	}
+
+	if file != nil {
+		tee.WriteTo(file) //nolint: errcheck
+	}
+	out.WriteTo(s.w) //nolint: errcheck
+}
+
+// Close closes the writer and waits for all the pending lines to be written.
+func (s *std) Close() error {
+	err := s.Writer.(*io.PipeWriter).Close()
+	<-s.done
+	return err
 }
 
 func writerFinalizer(writer *io.PipeWriter) {
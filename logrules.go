@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Log rule actions
+const (
+	ruleDrop      = "drop"
+	ruleReplace   = "replace"
+	ruleHighlight = "highlight"
+	rulePass      = "pass"
+)
+
+// A logRule rewrites or filters the output lines matching its pattern.
+// The drop and pass rules stop the evaluation of the following rules.
+type logRule struct {
+	Match  string `yaml:"match"`
+	Action string `yaml:"action"`
+	With   string `yaml:"with"`  // replace template, e.g. ${level} ${message}
+	Color  string `yaml:"color"` // highlight color, reverse video by default
+
+	pattern *regexp.Regexp
+	color   Color
+}
+
+func (r *logRule) UnmarshalYAML(value *yaml.Node) error {
+	type plain logRule
+	if err := value.Decode((*plain)(r)); err != nil {
+		return err
+	}
+
+	var err error
+	r.pattern, err = regexp.Compile(r.Match)
+	if err != nil {
+		return errors.Wrapf(err, "line %d: invalid log rule pattern", value.Line)
+	}
+
+	switch r.Action {
+	case ruleDrop, rulePass:
+	case ruleReplace:
+		if r.With != "" {
+			break
+		}
+		if r.pattern.NumSubexp() == 0 {
+			return errors.Errorf("line %d: replace log rule without template", value.Line)
+		}
+
+		// The captured groups are concatenated like with log_trim_pattern
+		for i := 1; i <= r.pattern.NumSubexp(); i++ {
+			r.With += fmt.Sprintf("${%d}", i)
+		}
+	case ruleHighlight:
+		code := "7"
+		if r.Color != "" {
+			if code, err = parseColor(r.Color); err != nil {
+				return errors.Wrapf(err, "line %d", value.Line)
+			}
+		}
+		r.color = Color("\033[" + code + "m")
+	default:
+		return errors.Errorf("line %d: unsupported log rule action %q", value.Line, r.Action)
+	}
+
+	return nil
+}
+
+// applyLogRules returns the line rewritten by the rules, false when it must be dropped.
+// The matches are highlighted only when colored is true.
+func applyLogRules(rules []*logRule, line []byte, colored bool) ([]byte, bool) {
+	for _, r := range rules {
+		if !r.pattern.Match(line) {
+			continue
+		}
+
+		switch r.Action {
+		case ruleDrop:
+			return nil, false
+		case rulePass:
+			return line, true
+		case ruleReplace:
+			line = r.pattern.ReplaceAll(line, []byte(r.With))
+		case ruleHighlight:
+			if colored {
+				line = r.pattern.ReplaceAllFunc(line, func(m []byte) []byte {
+					return append(append([]byte(r.color), m...), Reset...)
+				})
+			}
+		}
+	}
+
+	return line, true
+}
@@ -10,8 +10,14 @@ import (
 func main() {
 	var (
 		verbose bool
-		log     = &logger{w: os.Stdout}
+		log     = &logger{w: os.Stdout, files: &logFiles{}, colors: &colors{}, levels: &levels{}, redactor: &redactor{}, sinks: &sinks{}}
 		homedir string
+		project string
+		format  string
+		stamps  string
+		color   string
+		noColor bool
+		level   string
 	)
 
 	//
@@ -22,18 +28,47 @@ func main() {
 		Short:   "An awesome utility to manage all your processes in development environment",
 		Version: Version(),
 		Args:    cobra.NoArgs,
-		PersistentPreRunE: func(_ *cobra.Command, _ []string) (err error) {
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) (err error) {
 			homedir, err = os.Getwd()
 			if err != nil {
 				return err
 			}
 
-			return nil
+			if err = log.setTimestamps(stamps); err != nil {
+				return err
+			}
+
+			if err = log.setLevel(level); err != nil {
+				return err
+			}
+
+			switch {
+			case noColor:
+				color = colorNever
+			case !cmd.Flags().Changed("color") && os.Getenv("NO_COLOR") != "":
+				color = colorNever
+			}
+			if err = log.setColor(color); err != nil {
+				return err
+			}
+
+			return log.setFormat(format)
 		},
 	}
 	c.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Increase logger level")
+	c.PersistentFlags().StringVar(&format, "log-format", "", "Log format, text or json (default to settings.log_format)")
+	c.PersistentFlags().StringVar(&level, "log-level", "", "Hide the lines below the level: trace, debug, info, warn, error or fatal (default to settings.log_level)")
+	c.PersistentFlags().StringVar(&color, "color", colorAuto, "Colorize the output: always, auto or never")
+	c.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable the colors (same as --color=never)")
+	c.PersistentFlags().StringVar(&stamps, "timestamps", "", "Prepend timestamps to the log lines: rfc3339, time, relative or delta (default to settings.timestamps)")
+	c.PersistentFlags().Lookup("timestamps").NoOptDefVal = timestampTime
+	c.PersistentFlags().StringVarP(&project, "project-name", "p", "", "Project name (default to settings.project)")
 
-	c.AddCommand(command(log, homedir))
+	c.AddCommand(command(log, homedir, &project))
+	c.AddCommand(taskCommand(log, homedir, &project))
+	c.AddCommand(psCommand(&project))
+	c.AddCommand(scaleCommand(&project))
+	c.AddCommand(limitCommand())
 	c.AddCommand(&cobra.Command{
 		Use:   "version",
 		Short: "Version for composer",
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultMultilineMaxLines     = 200
+	defaultMultilineFlushTimeout = 250 * time.Millisecond
+)
+
+// A multiline groups the lines of a record (e.g. a stack trace) to print them as one block.
+// A record starts with a line matching the start pattern and ends with the next one.
+type multiline struct {
+	StartPattern string        `yaml:"start_pattern"`
+	MaxLines     int           `yaml:"max_lines"`
+	FlushTimeout time.Duration `yaml:"flush_timeout"` // since the last line of the record
+
+	start *regexp.Regexp
+}
+
+func (m *multiline) UnmarshalYAML(value *yaml.Node) error {
+	type plain multiline
+	if err := value.Decode((*plain)(m)); err != nil {
+		return err
+	}
+
+	if m.StartPattern == "" {
+		return errors.Errorf("line %d: multiline without start_pattern", value.Line)
+	}
+
+	var err error
+	m.start, err = regexp.Compile(m.StartPattern)
+	if err != nil {
+		return errors.Wrapf(err, "line %d: invalid multiline start_pattern", value.Line)
+	}
+
+	if m.MaxLines <= 0 {
+		m.MaxLines = defaultMultilineMaxLines
+	}
+	if m.FlushTimeout <= 0 {
+		m.FlushTimeout = defaultMultilineFlushTimeout
+	}
+
+	return nil
+}
+
+// group adds the line to the current record, the previous record is printed when the line starts a new one.
+func (s *std) group(line []byte) {
+	s.blockMu.Lock()
+	defer s.blockMu.Unlock()
+
+	if len(s.block) != 0 && (s.multiline.start.Match(line) || len(s.block) >= s.multiline.MaxLines) {
+		s.flush()
+	}
+	s.block = append(s.block, line)
+
+	if s.flushTimer == nil {
+		s.flushTimer = time.AfterFunc(s.multiline.FlushTimeout, s.flushBlock)
+	} else {
+		s.flushTimer.Reset(s.multiline.FlushTimeout)
+	}
+}
+
+// flushBlock prints the current record.
+func (s *std) flushBlock() {
+	s.blockMu.Lock()
+	defer s.blockMu.Unlock()
+
+	s.flush()
+}
+
+func (s *std) flush() {
+	if len(s.block) == 0 {
+		return
+	}
+
+	s.print(s.block)
+	s.block = nil
+}
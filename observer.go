@@ -1,5 +1,7 @@
 package main
 
+import "slices"
+
 type publisher interface {
 	publish(value any)
 }
@@ -20,6 +22,12 @@ func (observers *observable) attachObserver(a observer) {
 	*observers = append(*observers, a)
 }
 
+func (observers *observable) detachObserver(a observer) {
+	*observers = slices.DeleteFunc(*observers, func(o observer) bool {
+		return o == a
+	})
+}
+
 func (observers observable) publish(status map[string][]string) {
 	for _, obs := range observers {
 		obs.notify(status)
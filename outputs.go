@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"maps"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// setOutput matches the lines publishing an output like `::set-output name=token::abc`.
+var setOutput = regexp.MustCompile(`^\s*::set-output name=([\w.-]+)::(.*)$`)
+
+// linkOutputs makes the outputs of the awaited processes available to their waiters.
+func linkOutputs(processes []*process) {
+	byName := make(map[string]*process)
+	for _, p := range processes {
+		byName[p.Name] = p
+	}
+
+	for _, p := range processes {
+		for _, c := range p.Hooks.Wait {
+			if awaited, ok := byName[c.Service]; ok {
+				p.awaited = append(p.awaited, awaited)
+			}
+		}
+	}
+}
+
+// setOutputs records the given outputs of the process.
+func (p *process) setOutputs(outputs map[string]string) {
+	if len(outputs) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.outputs == nil {
+		p.outputs = make(map[string]string)
+	}
+	maps.Copy(p.outputs, outputs)
+}
+
+// importOutputs adds the outputs of the awaited processes to the given environment of the process.
+// The variables already defined in the environment take precedence.
+func (p *process) importOutputs(env map[string]string) {
+	for _, awaited := range p.awaited {
+		awaited.mu.Lock()
+		for k, v := range awaited.outputs {
+			if _, ok := env[k]; !ok {
+				env[k] = v
+			}
+		}
+		awaited.mu.Unlock()
+	}
+
+	p.Logger.redactor.addSecrets(env)
+}
+
+// outputFile creates the file where the process's commands can write their outputs as KEY=VALUE lines.
+func outputFile() (string, error) {
+	f, err := os.CreateTemp("", "composer-output-*")
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// readOutputFile returns the outputs written in the given file.
+func readOutputFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	outputs := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), "=")
+		if k = strings.TrimSpace(k); ok && k != "" {
+			outputs[k] = v
+		}
+	}
+	return outputs, scanner.Err()
+}
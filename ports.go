@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// portReference matches the references to the ports of the services like ${services.api.ports.http}.
+var portReference = regexp.MustCompile(`\$\{services\.([\w.-]+)\.ports\.([\w-]+)\}`)
+
+var allocated = struct {
+	sync.Mutex
+	ports map[int]bool
+}{ports: make(map[int]bool)}
+
+// freePort returns a free TCP port not already allocated by composer.
+func freePort() (int, error) {
+	allocated.Lock()
+	defer allocated.Unlock()
+
+	for range 10 {
+		l, err := net.Listen("tcp", ":0")
+		if err != nil {
+			return 0, err
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close() //nolint: errcheck
+
+		if !allocated.ports[port] {
+			allocated.ports[port] = true
+			return port, nil
+		}
+	}
+
+	return 0, errors.New("could not find a free port")
+}
+
+// portEnv returns the name of the environment variable holding the given port.
+func portEnv(name string) string {
+	return "PORT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// errReplicatedPorts is returned when the ports of a replicated service are referenced instead of the ones of an instance.
+func errReplicatedPorts(name string) error {
+	return errors.Errorf("%s is replicated, reference the ports of one of its instances like %s", name, replicaName(name, 1))
+}
+
+// validatePorts checks the ports are either auto or a valid port number.
+// The replicas cannot share a fixed port.
+func (p *process) validatePorts() error {
+	for name, port := range p.Ports {
+		if port == "auto" {
+			continue
+		}
+
+		if p.Replicas != nil {
+			return errors.Errorf("port %s: the replicas cannot share the fixed port %s, use auto", name, port)
+		}
+
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return errors.Errorf("invalid port %s: %s", name, port)
+		}
+	}
+	return nil
+}
+
+// allocatePorts picks the automatic ports of the process and exports all its ports in its environment.
+func (p *process) allocatePorts() error {
+	if len(p.Ports) == 0 {
+		return nil
+	}
+
+	if p.Environment == nil {
+		p.Environment = make(map[string]string)
+	}
+
+	for name, port := range p.Ports {
+		if port == "auto" {
+			n, err := freePort()
+			if err != nil {
+				return errors.Wrapf(err, "port %s", name)
+			}
+			port = strconv.Itoa(n)
+			p.Ports[name] = port
+		}
+
+		p.Environment[portEnv(name)] = port
+	}
+	return nil
+}
+
+// resolvePorts replaces the references to the ports of the other services in the environment and the command of the process.
+func (p *process) resolvePorts(lookup func(name string) (*process, error)) error {
+	var err error
+	resolve := func(s string) string {
+		return portReference.ReplaceAllStringFunc(s, func(ref string) string {
+			m := portReference.FindStringSubmatch(ref)
+
+			service, lerr := lookup(m[1])
+			if lerr != nil {
+				err = errors.Wrap(lerr, ref)
+				return ref
+			}
+
+			port, ok := service.Ports[m[2]]
+			if !ok {
+				err = errors.Errorf("%s: unknown port %s of %s", ref, m[2], m[1])
+				return ref
+			}
+			return port
+		})
+	}
+
+	for k, v := range p.Environment {
+		p.Environment[k] = resolve(v)
+	}
+	p.Command = resolve(p.Command)
+	for i, arg := range p.Exec {
+		p.Exec[i] = resolve(arg)
+	}
+
+	return err
+}
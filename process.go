@@ -4,13 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"regexp"
-	"slices"
+	"runtime"
 	"strings"
 	"sync"
 
 	"github.com/mdouchement/upathex"
+	"github.com/pkg/errors"
 	"mvdan.cc/sh/v3/expand"
 	"mvdan.cc/sh/v3/interp"
 	"mvdan.cc/sh/v3/syntax"
@@ -19,90 +21,270 @@ import (
 type process struct {
 	Name           string
 	PaddedName     string
-	Hooks          map[string][]string `yaml:"hooks"`
-	Pwd            string              `yaml:"pwd"`
-	Command        string              `yaml:"command"`
-	Environment    map[string]string   `yaml:"environment"`
+	Hooks          hooks             `yaml:"hooks"`
+	Deps           []string          `yaml:"deps"` // tasks only
+	Pwd            string            `yaml:"pwd"`
+	Command        string            `yaml:"command"`
+	Exec           []string          `yaml:"exec"`  // run directly, without shell
+	Shell          string            `yaml:"shell"` // run command with the given system shell
+	TTY            bool              `yaml:"tty"`
+	TTYSize        *winsize          `yaml:"tty_size"`
+	Stdin          bool              `yaml:"stdin"` // can receive composer's input
+	Limits         *limits           `yaml:"limits"`
+	Environment    map[string]string `yaml:"environment"`
 	Logger         *logger
-	LogTrimPattern string `yaml:"log_trim_pattern"`
-	IgnoreError    bool   `yaml:"ignore_error"`
-	Cancel         context.CancelFunc
-	Done           chan struct{}
-
-	mu          sync.Mutex
-	waiting     context.Context
-	doneWaiting func()
-	homedir     string
-}
+	LogTrimPattern string     `yaml:"log_trim_pattern"`
+	LogRules       []*logRule `yaml:"log_rules"`
+	Multiline      *multiline `yaml:"multiline"`
+	LogFile        string     `yaml:"log_file"`
+	LogFormat      string     `yaml:"log_format"`   // text or json
+	LogTemplate    string     `yaml:"log_template"` // compact form of the JSON lines
+	Color          string     `yaml:"color"`        // name, bright_name or 256 colors number
+	LogLevel       string     `yaml:"log_level"`
+	IgnoreError    bool       `yaml:"ignore_error"`
+	Watch          *watch     `yaml:"watch"`
 
-func (p *process) wait() {
-	if p.waiting != nil {
-		<-p.waiting.Done()
-	}
-}
+	MemoryWarnThreshold byteSize `yaml:"memory_warn_threshold"`
 
-func (p *process) update(status map[string][]string) {
-	for _, processName := range status["stopped"] {
-		for i, name := range p.Hooks["wait"] {
-			if name == processName {
-				// delete any stopped process from waiting list
-				p.Hooks["wait"] = slices.Delete(p.Hooks["wait"], i, i+1)
-			}
-		}
-	}
+	Ports             map[string]string `yaml:"ports"` // port number or auto
+	Replicas          *int              `yaml:"replicas"`
+	Schedule          *schedule         `yaml:"schedule"`
+	ConcurrencyPolicy string            `yaml:"concurrency_policy"` // skip or queue the runs overlapping the previous one
 
-	if len(p.Hooks["wait"]) == 0 && p.doneWaiting != nil {
-		p.doneWaiting()
-	}
+	Cancel context.CancelFunc
+	Done   chan struct{}
+
+	mu           sync.Mutex
+	stopping     sync.Once
+	task         bool
+	waitErr      error
+	awaitSuccess map[string]bool // awaited tasks that must exit successfully
+	waiting      context.Context
+	doneWaiting  func()
+	logWatchers  []*logWatcher
+	logged       map[string]bool          // patterns of the watchers matched by the current run
+	children     map[*os.Process]struct{} // running commands
+	groups       map[*os.Process]struct{} // process groups created by the commands
+	restarts     chan struct{}
+	input        *stdinMux
+	cgroup       *cgroup
+	usage        usage
+	ticks        uint64 // CPU time of the last usage sample
+	memoryWarned bool
+	retired      bool // stopped by a scale down
+	started      bool // the command is started, once pre_start succeeded
+	awaited      []*process
+	outputs      map[string]string // published by the commands
+	color        string            // SGR code of Color
+	replicaOf    string            // name of the replicated service
+	logLevel     level
+	trim         *regexp.Regexp
+	jsonLines    *jsonLines
+	env          map[string]string // environment of the current run
+	homedir      string
+
+	readyPatterns []*regexp.Regexp // log patterns awaited by the other services
 }
 
 func (p *process) run(ctx context.Context) error {
 	logout := p.Logger.WithPrefixName(p.PaddedName).Stdout()
 	logerr := p.Logger.WithPrefixName(p.PaddedName).Stderr()
+	defer logout.Close()
+	defer logerr.Close()
 
-	if p.LogTrimPattern != "" {
-		trim, err := regexp.Compile(p.LogTrimPattern)
+	logout.trim = p.trim
+	logerr.trim = p.trim
+	logout.rules = p.LogRules
+	logerr.rules = p.LogRules
+	logout.json = p.jsonLines
+	logerr.json = p.jsonLines
+	logout.multiline = p.Multiline
+	logerr.multiline = p.Multiline
+
+	logout.observe = p.observeLine
+	logerr.observe = p.observeLine
+
+	// The hooks run by other goroutines read the environment of the run
+	env := maps.Clone(p.Environment)
+	p.importOutputs(env)
+
+	output, err := outputFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(output) //nolint: errcheck
+	env["COMPOSER_OUTPUT"] = output
+
+	p.mu.Lock()
+	p.env = env
+	p.logged = nil
+	p.mu.Unlock()
+
+	var stdin io.Reader
+	if p.Stdin && p.input != nil {
+		stdin = p.input.open(p.Name)
+		defer p.input.close(p.Name)
+	}
+
+	command, err := p.command(stdin, logout, logerr)
+	if err != nil {
+		return err
+	}
+
+	if p.Limits != nil && runtime.GOOS == "windows" {
+		p.Logger.WithPrefixName(p.PaddedName).Warn("limits are not supported on Windows")
+	}
+
+	var cg *cgroup
+	if p.Limits.cgroup() {
+		cg, err = p.newCgroup()
 		if err != nil {
-			return err
+			p.Logger.WithPrefixName(p.PaddedName).Warn("cgroup limits not applied: ", err)
+		} else {
+			p.mu.Lock()
+			p.cgroup = cg
+			p.mu.Unlock()
+
+			defer func() {
+				p.mu.Lock()
+				p.cgroup = nil
+				p.mu.Unlock()
+				cg.remove()
+			}()
+		}
+	}
+
+	// The process can be stopped during its pre_start hook
+	p.mu.Lock()
+	if p.waitErr != nil {
+		p.mu.Unlock()
+		return context.Canceled
+	}
+	ctx, p.Cancel = context.WithCancel(ctx)
+	p.mu.Unlock()
+
+	if err = p.runHook(ctx, "pre_start", p.Hooks.PreStart); err != nil {
+		if ctx.Err() != nil {
+			return context.Canceled
 		}
+		return err
+	}
+
+	p.mu.Lock()
+	p.started = true
+	p.mu.Unlock()
 
-		logout.trim = trim
-		logerr.trim = trim
+	if p.Watch != nil {
+		go p.watchChanges(ctx)
 	}
 
-	//
+	if p.Hooks.PostStart != nil {
+		ready := p.ready()
+		go func() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ready:
+			}
 
-	environ := os.Environ()
-	for k, v := range p.Environment {
-		environ = append(environ, fmt.Sprintf("%s=%s", k, v))
+			if err := p.runHook(ctx, "post_start", p.Hooks.PostStart); err != nil && ctx.Err() == nil {
+				p.Logger.WithPrefixName(p.PaddedName).Error(err)
+			}
+		}()
 	}
 
-	//
+	switch {
+	case p.Schedule != nil:
+		err = p.runScheduled(ctx, command)
+	case p.Watch != nil && p.Watch.Action == "restart":
+		err = p.runRestartable(ctx, command)
+	default:
+		err = command(ctx)
+	}
 
-	workdir := p.homedir
-	if p.Pwd != "" {
-		workdir = p.Pwd
+	if cg != nil && cg.oomKilled() {
+		p.Logger.WithPrefixName(p.PaddedName).Error(fmt.Sprintf("killed by the OOM killer (memory limit %d bytes)", cg.limit))
+		if err != nil {
+			err = errors.Wrapf(errOOMKilled, "%v", err)
+		} else {
+			err = errOOMKilled
+		}
 	}
 
-	workdir = upathex.ExpandEnvWithCustom(workdir, p.Environment)
+	if outputs, oerr := readOutputFile(output); oerr == nil {
+		p.setOutputs(outputs)
+	}
+
+	// Cleanup must occur even when composer is shutting down
+	if herr := p.runHook(context.Background(), "post_stop", p.Hooks.PostStop); herr != nil {
+		p.Logger.WithPrefixName(p.PaddedName).Error(herr)
+	}
+
+	return err
+}
 
-	var err error
-	workdir, err = upathex.ExpandTilde(workdir)
+// command returns the function running the process's command according its execution mode.
+func (p *process) command(stdin io.Reader, stdout, stderr io.Writer) (func(ctx context.Context) error, error) {
+	run, err := p.runner()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	//
+	if p.TTY {
+		return func(ctx context.Context) error {
+			return p.runTTY(ctx, run, stdin, stdout)
+		}, nil
+	}
+
+	return func(ctx context.Context) error {
+		return run(ctx, stdin, stdout, stderr)
+	}, nil
+}
+
+// runner returns the function running the process's command with the given outputs.
+func (p *process) runner() (func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error, error) {
+	switch {
+	case len(p.Exec) != 0:
+		return func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			return p.spawn(ctx, p.Exec, stdin, stdout, stderr)
+		}, nil
+	case p.Shell != "":
+		return func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+			return p.spawn(ctx, []string{p.Shell, "-c", p.Command}, stdin, stdout, stderr)
+		}, nil
+	}
 
 	command, err := syntax.NewParser().Parse(strings.NewReader(p.Command), "")
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		shell, err := p.shell(stdin, stdout, stderr)
+		if err != nil {
+			return err
+		}
+
+		return shell.Run(ctx, command)
+	}, nil
+}
+
+// shell returns a new shell runner configured with the process environment.
+// A nil stdin reads nothing.
+func (p *process) shell(stdin io.Reader, stdout, stderr io.Writer) (*interp.Runner, error) {
+	environ := p.environ()
+
+	//
+
+	workdir, err := p.workdir()
+	if err != nil {
+		return nil, err
 	}
 
 	//
 	//
 
-	shell, err := interp.New(
+	return interp.New(
 		interp.Dir(workdir),
 		interp.Env(expand.ListEnviron(environ...)),
 
@@ -113,30 +295,148 @@ func (p *process) run(ctx context.Context) error {
 			return interp.DefaultOpenHandler()(ctx, path, flag, perm)
 		}),
 
-		interp.StdIO(os.Stdin, logout, logerr),
+		interp.ExecHandlers(func(interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+			return p.execHandler(killTimeout)
+		}),
+
+		interp.StdIO(stdin, stdout, stderr),
 	)
-	if err != nil {
-		return err
+}
+
+// environ returns the composer's environment overridden by the process's one.
+func (p *process) environ() []string {
+	environ := os.Environ()
+	for k, v := range p.environment() {
+		environ = append(environ, fmt.Sprintf("%s=%s", k, v))
 	}
+	return environ
+}
 
+// environment returns the environment of the current run, the configured one before the first run.
+// It must not be modified.
+func (p *process) environment() map[string]string {
 	p.mu.Lock()
-	ctx, p.Cancel = context.WithCancel(ctx)
-	p.mu.Unlock()
+	defer p.mu.Unlock()
 
-	return shell.Run(ctx, command)
+	if p.env != nil {
+		return p.env
+	}
+	return p.Environment
+}
+
+// workdir returns the expanded working directory of the process.
+func (p *process) workdir() (string, error) {
+	workdir := p.homedir
+	if p.Pwd != "" {
+		workdir = p.Pwd
+	}
+
+	workdir = upathex.ExpandEnvWithCustom(workdir, p.environment())
+	return upathex.ExpandTilde(workdir)
 }
 
 func (p *process) wantedDeadOrDead() []string {
-	return p.Hooks["kill"]
+	return p.Hooks.Kill
 }
 
 // stop terminates the underlying process whether it is started
 func (p *process) stop() {
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	if p.Cancel == nil {
+		// Not started yet, make sure it never will
+		p.stopWaiting(errAborted)
+		p.mu.Unlock()
+		return
+	}
+	cancel := p.Cancel
+	started := p.started
+	p.mu.Unlock()
+
+	// Only the started commands have something to flush
+	if started {
+		p.stopping.Do(func() {
+			select {
+			case <-p.Done:
+				// Already exited, nothing to flush
+			default:
+				if err := p.runHook(context.Background(), "pre_stop", p.Hooks.PreStop); err != nil {
+					p.Logger.WithPrefixName(p.PaddedName).Error(err)
+				}
+			}
+		})
+	}
+
+	cancel()
+	p.Logger.WithPrefixName(p.PaddedName).Warn("stopped by Composer")
+}
+
+// validate checks the consistency of the process definition.
+func (p *process) validate() error {
+	switch {
+	case len(p.Exec) != 0 && p.Command != "":
+		return errors.New("command and exec are mutually exclusive")
+	case len(p.Exec) != 0 && p.Shell != "":
+		return errors.New("shell cannot be used with exec")
+	case len(p.Exec) == 0 && p.Command == "" && p.Shell != "":
+		return errors.New("shell requires a command")
+	case p.Schedule != nil && p.Watch != nil && p.Watch.Action == "restart":
+		return errors.New("a scheduled service cannot be restarted on changes")
+	}
+
+	for _, h := range []*hook{p.Hooks.PreStart, p.Hooks.PreStop, p.Hooks.PostStop} {
+		if h != nil && h.Ready != "" {
+			return errors.New("only the post_start hook can have a ready pattern")
+		}
+	}
+
+	if p.Replicas != nil && *p.Replicas < 0 {
+		return errors.New("negative number of replicas")
+	}
+
+	if err := p.validatePorts(); err != nil {
+		return err
+	}
+
+	if p.Color != "" {
+		var err error
+		if p.color, err = parseColor(p.Color); err != nil {
+			return err
+		}
+	}
 
-	if p.Cancel != nil {
-		p.Cancel()
-		p.Logger.WithPrefixName(p.PaddedName).Warn("stopped by Composer")
+	if p.LogTrimPattern != "" {
+		var err error
+		if p.trim, err = regexp.Compile(p.LogTrimPattern); err != nil {
+			return errors.Wrap(err, "invalid log_trim_pattern")
+		}
 	}
+
+	switch p.LogFormat {
+	case "", logFormatText:
+		if p.LogTemplate != "" {
+			return errors.New("log_template requires the json log_format")
+		}
+	case logFormatJSON:
+		var err error
+		if p.jsonLines, err = newJSONLines(p.LogTemplate); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("unsupported log format %s", p.LogFormat)
+	}
+
+	if p.LogLevel != "" {
+		var err error
+		if p.logLevel, err = parseLevel(p.LogLevel); err != nil {
+			return err
+		}
+	}
+
+	switch p.ConcurrencyPolicy {
+	case "", "skip", "queue":
+	default:
+		return errors.Errorf("unsupported concurrency policy %s", p.ConcurrencyPolicy)
+	}
+
+	return nil
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"sync"
+
+	"github.com/pkg/errors"
 )
 
 type processor struct {
@@ -11,38 +13,85 @@ type processor struct {
 	errors    chan error
 	terminate chan []string
 	reg       *registry
+	subreaper bool
+	usage     usageSettings
+	done      chan struct{}
 
 	m           sync.Mutex
 	termination bool
+	ctx         context.Context
+	template    string // padded name format
+	running     sync.WaitGroup
 }
 
 func (p *processor) perform(ctx context.Context) {
 	go p.terminator()
 	go p.handleErrors()
 
-	template := fmt.Sprintf("%%%ds", p.getPadding())
-	var n sync.WaitGroup
+	if p.subreaper {
+		if err := setSubreaper(); err != nil {
+			p.log.WithPrefixName("processor").Warn(err)
+			p.subreaper = false
+		} else {
+			go p.reapOrphans(p.done)
+		}
+	}
 
+	go p.monitor(p.usage.Interval, p.usage.Summary, p.done)
+
+	p.m.Lock()
+	p.ctx = ctx
+	p.template = fmt.Sprintf("%%%ds", getPadding(p.reg.processes(), p.reg.replicaSetNames()))
 	for _, proc := range p.reg.readyProcesses() {
-		proc.PaddedName = fmt.Sprintf(template, proc.Name)
+		p.start(proc)
+	}
+	p.m.Unlock()
 
-		n.Add(1)
-		go func(proc *process) {
-			defer n.Done()
+	p.running.Wait()
+}
 
-			proc.wait()
-			p.reg.updateStatus(proc, "running")
-			err := proc.run(ctx)
-			if !proc.IgnoreError && err != nil && !p.reg.isAllowedToBeKilled(proc.Name) {
-				p.errors <- err
+// start runs the given process once its wait conditions are satisfied.
+// The processor's lock must be held.
+func (p *processor) start(proc *process) {
+	proc.PaddedName = fmt.Sprintf(p.template, proc.Name)
+
+	p.running.Add(1)
+	go func() {
+		defer p.running.Done()
+
+		if err := proc.wait(); err != nil {
+			switch {
+			case err == errAborted:
+			case proc.IgnoreError:
+				proc.Logger.WithPrefixName(proc.PaddedName).Warn("not started: ", err)
+			default:
+				p.errors <- errors.Wrap(err, proc.Name)
 			}
-			close(proc.Done)
 			p.reg.updateStatus(proc, "stopped")
-			p.terminate <- proc.wantedDeadOrDead()
-		}(proc)
-	}
+			if proc.isRetired() {
+				p.reg.unregister(proc)
+			}
+			close(proc.Done)
+			return
+		}
 
-	n.Wait()
+		p.reg.updateStatus(proc, "running")
+		err := proc.run(p.ctx)
+		// A scheduled service only stops with composer and a retired replica is not missed
+		expected := proc.Schedule != nil || proc.isRetired()
+		if !expected && !proc.IgnoreError && err != nil && !p.reg.isAllowedToBeKilled(proc) {
+			p.errors <- err
+		}
+		p.reg.exited(proc, exitReason(err))
+		p.reg.updateStatus(proc, "stopped")
+		if proc.isRetired() {
+			p.reg.unregister(proc)
+		}
+		close(proc.Done)
+		if !expected {
+			p.terminate <- proc.wantedDeadOrDead()
+		}
+	}()
 }
 
 func (p *processor) handleErrors() {
@@ -61,7 +110,8 @@ func (p *processor) handleErrors() {
 			p.log.WithPrefixName("processor").Error(fmt.Sprintf("%s ; %#v", err.Error(), err))
 		}
 
-		p.shutdown()
+		// The errors of the processes stopped by the shutdown are drained meanwhile
+		go p.shutdown()
 		termination = true
 	}
 }
@@ -73,16 +123,23 @@ func (p *processor) terminator() {
 }
 
 func (p *processor) stopAllGivenNames(names []string) {
-	for _, name := range names {
-		p.log.WithPrefixName("processor").Warn(name)
-		process, status := p.reg.getProcess(name)
-		switch status {
-		case "ready":
-			p.reg.updateStatus(process, "stopped")
-		case "running":
-			p.stop(process)
-		case "stopped":
-			// nothing to do here
+	for _, service := range names {
+		for _, name := range p.reg.instances(service) {
+			// Skips the replicas retired by a scale down, they are already stopped
+			if process, ok := p.reg.lookup(name); !ok || process.isRetired() {
+				continue
+			}
+
+			p.log.WithPrefixName("processor").Warn(name)
+			process, status := p.reg.getProcess(name)
+			switch status {
+			case "ready":
+				p.reg.updateStatus(process, "stopped")
+			case "running":
+				p.stop(process)
+			case "stopped":
+				// nothing to do here
+			}
 		}
 	}
 }
@@ -103,8 +160,21 @@ func (p *processor) shutdown() {
 		p.stop(process)
 	}
 
-	for _, process := range p.reg.runningProcesses() {
-		p.stop(process)
+	running := p.reg.runningProcesses()
+	stopAll(running, p.stop)
+
+	// Wait the process trees to be terminated before leaving
+	for _, process := range running {
+		<-process.Done
+	}
+
+	for _, process := range p.reg.processes() {
+		process.cleanupGroups()
+	}
+
+	close(p.done)
+	if p.subreaper {
+		p.killOrphans()
 	}
 }
 
@@ -113,12 +183,32 @@ func (p *processor) stop(process *process) {
 	p.reg.updateStatus(process, "stopped")
 }
 
-func (p *processor) getPadding() int {
+// stopAll stops the given processes in parallel, so their pre_stop hooks run concurrently.
+func stopAll(processes []*process, stop func(*process)) {
+	var wg sync.WaitGroup
+	for _, process := range processes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stop(process)
+		}()
+	}
+	wg.Wait()
+}
+
+// getPadding returns the length of the longest name,
+// leaving room for up to 99 instances of the replicated services so the ones added by a scale are aligned.
+func getPadding(processes []*process, replicated []string) int {
 	var length int
-	for _, process := range p.reg.processes() {
+	for _, process := range processes {
 		if l := len(process.Name); l > length {
 			length = l
 		}
 	}
+	for _, name := range replicated {
+		if l := len(replicaName(name, 99)); l > length {
+			length = l
+		}
+	}
 	return length
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const defaultProject = "default"
+
+var projectPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// projectName returns the project name given by the flag, the settings or the default one.
+func projectName(flag, setting string) (string, error) {
+	name := defaultProject
+	switch {
+	case flag != "":
+		name = flag
+	case setting != "":
+		name = setting
+	}
+
+	if !projectPattern.MatchString(name) {
+		return "", errors.Errorf("invalid project name %q", name)
+	}
+	return name, nil
+}
+
+// projectFile namespaces the given file path with the project name, e.g. composer.log becomes composer.myproject.log.
+// The path is left untouched for the default project.
+func projectFile(path, project string) string {
+	if project == defaultProject {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + project + ext
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const redacted = "****"
+
+// The environment variables holding secrets, by suffix of their names.
+var secretSuffixes = []string{"_TOKEN", "_PASSWORD", "_SECRET"}
+
+// minSecretLength is the length under which a secret cannot be told apart from the regular output.
+const minSecretLength = 4
+
+// redactor hides the secrets from the output, shared by all the loggers.
+type redactor struct {
+	mu       sync.RWMutex
+	patterns []*regexp.Regexp
+	secrets  []string // longest first, so a secret containing another one is fully redacted
+}
+
+// setPatterns compiles the patterns of the secrets to redact.
+func (r *redactor) setPatterns(patterns []string) error {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return errors.Wrap(err, "invalid redact pattern")
+		}
+		compiled = append(compiled, re)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.patterns = compiled
+	return nil
+}
+
+// addSecrets adds the values of the secret variables of the given environment.
+func (r *redactor) addSecrets(environment map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, v := range environment {
+		if len(v) < minSecretLength || !isSecret(k) {
+			continue
+		}
+
+		if !slices.Contains(r.secrets, v) {
+			r.secrets = append(r.secrets, v)
+		}
+	}
+
+	slices.SortFunc(r.secrets, func(a, b string) int {
+		return len(b) - len(a)
+	})
+}
+
+func isSecret(name string) bool {
+	name = strings.ToUpper(name)
+	for _, suffix := range secretSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact replaces the secrets of the line.
+// Only the captured groups are replaced when a pattern has some, the whole match otherwise.
+func (r *redactor) redact(line []byte) []byte {
+	if r == nil {
+		return line
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, secret := range r.secrets {
+		line = bytes.ReplaceAll(line, []byte(secret), []byte(redacted))
+	}
+
+	for _, re := range r.patterns {
+		if re.NumSubexp() == 0 {
+			line = re.ReplaceAll(line, []byte(redacted))
+			continue
+		}
+
+		matches := re.FindAllSubmatchIndex(line, -1)
+		if matches == nil {
+			continue
+		}
+
+		var buf bytes.Buffer
+		var last int
+		for _, m := range matches {
+			for i := 2; i < len(m); i += 2 {
+				if m[i] < last { // unmatched or nested group
+					continue
+				}
+				buf.Write(line[last:m[i]]) //nolint: errcheck
+				buf.WriteString(redacted)  //nolint: errcheck
+				last = m[i+1]
+			}
+		}
+		buf.Write(line[last:]) //nolint: errcheck
+		line = buf.Bytes()
+	}
+
+	return line
+}
@@ -1,17 +1,44 @@
 package main
 
 import (
+	"context"
 	"slices"
 	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Exit reasons
+const (
+	exitSucceeded = "succeeded"
+	exitFailed    = "failed"
+	exitStopped   = "stopped"
+	exitOOMKilled = "oom_killed"
 )
 
+// exitReason returns the exit reason for the given run error.
+func exitReason(err error) string {
+	switch {
+	case err == nil:
+		return exitSucceeded
+	case errors.Is(err, errOOMKilled):
+		return exitOOMKilled
+	case errors.Is(err, context.Canceled):
+		return exitStopped
+	default:
+		return exitFailed
+	}
+}
+
 type registry struct {
 	observable
 	sync.RWMutex
 	ready         map[string]*process
 	running       map[string]*process
 	stopped       map[string]*process
+	exits         map[string]string // exit reason of stopped processes
 	licenseToKill []string
+	replicaSets   map[string]*replicaSet
 }
 
 func newRegistry() *registry {
@@ -19,18 +46,55 @@ func newRegistry() *registry {
 		ready:         make(map[string]*process),
 		running:       make(map[string]*process),
 		stopped:       make(map[string]*process),
+		exits:         make(map[string]string),
 		licenseToKill: make([]string, 0, 50),
+		replicaSets:   make(map[string]*replicaSet),
 	}
 }
 
 func (r *registry) register(p *process) {
-	r.attachObserver(observerFunc(p.update))
-
 	r.Lock()
 	defer r.Unlock()
 
+	r.attachObserver(p)
 	r.ready[p.Name] = p
-	r.licenseToKill = append(r.licenseToKill, p.Hooks["kill"]...)
+	r.licenseToKill = append(r.licenseToKill, p.Hooks.Kill...)
+}
+
+// unregister removes the given stopped process.
+func (r *registry) unregister(p *process) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.detachObserver(p)
+	delete(r.stopped, p.Name)
+	delete(r.exits, p.Name)
+}
+
+func (r *registry) registerReplicaSet(set *replicaSet) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.replicaSets[set.name] = set
+}
+
+func (r *registry) replicaSetNames() []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	names := make([]string, 0, len(r.replicaSets))
+	for name := range r.replicaSets {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (r *registry) replicaSet(name string) (*replicaSet, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	set, ok := r.replicaSets[name]
+	return set, ok
 }
 
 func (r *registry) updateStatus(p *process, status string) {
@@ -40,14 +104,16 @@ func (r *registry) updateStatus(p *process, status string) {
 		delete(r.ready, p.Name)
 		r.running[p.Name] = p
 	case "stopped":
+		delete(r.ready, p.Name)
 		delete(r.running, p.Name)
 		r.stopped[p.Name] = p
 	default:
 		panic("Unsupported status") // Should never occur
 	}
+	observers := slices.Clone(r.observable)
 	r.Unlock()
 
-	r.publish(r.status())
+	observers.publish(r.status())
 }
 
 func (r *registry) status() map[string][]string {
@@ -64,16 +130,58 @@ func (r *registry) status() map[string][]string {
 	for name := range r.stopped {
 		status["stopped"] = append(status["stopped"], name)
 	}
+	for name, reason := range r.exits {
+		if reason == exitSucceeded {
+			status["succeeded"] = append(status["succeeded"], name)
+		}
+	}
 	status["license_to_kill"] = append(status["license_to_kill"], r.licenseToKill...)
 
 	return status
 }
 
-func (r *registry) isAllowedToBeKilled(name string) bool {
+// exited records why the given process exited.
+// It must be called before its status is updated to stopped.
+func (r *registry) exited(p *process, reason string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.exits[p.Name] = reason
+}
+
+func (r *registry) exitReason(name string) string {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.exits[name]
+}
+
+func (r *registry) isAllowedToBeKilled(p *process) bool {
+	r.RLock()
+	defer r.RUnlock()
+
+	return slices.Contains(r.licenseToKill, p.Name) || p.replicaOf != "" && slices.Contains(r.licenseToKill, p.replicaOf)
+}
+
+// instances returns the names of the registered instances of the given service, the service itself when it is not replicated.
+func (r *registry) instances(name string) []string {
 	r.RLock()
 	defer r.RUnlock()
 
-	return slices.Contains(r.licenseToKill, name)
+	if _, ok := r.replicaSets[name]; !ok {
+		return []string{name}
+	}
+
+	var names []string
+	for _, processes := range []map[string]*process{r.ready, r.running, r.stopped} {
+		for _, p := range processes {
+			if p.replicaOf == name {
+				names = append(names, p.Name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
 }
 
 func (r *registry) getProcess(name string) (*process, string) {
@@ -90,6 +198,30 @@ func (r *registry) getProcess(name string) (*process, string) {
 	panic("WTF?! Unknown process!")
 }
 
+// lookup returns the registered process with the given name.
+func (r *registry) lookup(name string) (*process, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, processes := range []map[string]*process{r.ready, r.running, r.stopped} {
+		if p, ok := processes[name]; ok {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// lookupPorts returns the registered process whose ports are referenced by the given name.
+func (r *registry) lookupPorts(name string) (*process, error) {
+	if _, ok := r.replicaSet(name); ok {
+		return nil, errReplicatedPorts(name)
+	}
+	if p, ok := r.lookup(name); ok {
+		return p, nil
+	}
+	return nil, errors.Errorf("unknown service %s", name)
+}
+
 func (r *registry) processes() []*process {
 	ps := append(r.readyProcesses(), r.runningProcesses()...)
 	return append(ps, r.stoppedProcesses()...)
@@ -97,16 +229,14 @@ func (r *registry) processes() []*process {
 
 func (r *registry) shutdown() {
 	r.Lock()
-	defer r.Unlock()
-
 	// Avoid ready process to start
 	for name := range r.ready {
 		delete(r.ready, name)
 	}
+	r.Unlock()
 
-	for _, process := range r.running {
-		process.stop()
-	}
+	// The pre_stop hooks must not hold the registry
+	stopAll(r.runningProcesses(), (*process).stop)
 }
 
 func (r *registry) readyProcesses() []*process {
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// A replicaSet creates the instances of a replicated service from its definition.
+type replicaSet struct {
+	name string
+	node yaml.Node // service definition
+
+	mu       sync.Mutex
+	replicas int
+	prepare  func(p *process) error
+}
+
+func replicaName(name string, index int) string {
+	return fmt.Sprintf("%s.%d", name, index)
+}
+
+// replica returns a new instance of the service with the given index (starting at 1).
+// Each instance gets its index in COMPOSER_REPLICA_INDEX and, when the service defines a PORT, its own port.
+func (s *replicaSet) replica(index int) (*process, error) {
+	p := new(process)
+	if err := s.node.Decode(p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, errors.Wrapf(err, "service %s", s.name)
+	}
+
+	if p.Environment == nil {
+		p.Environment = make(map[string]string)
+	}
+	p.Environment["COMPOSER_REPLICA_INDEX"] = strconv.Itoa(index)
+	if port, ok := p.Environment["PORT"]; ok {
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, errors.Wrapf(err, "service %s: invalid PORT", s.name)
+		}
+		p.Environment["PORT"] = strconv.Itoa(n + index - 1)
+	}
+
+	p.Name = replicaName(s.name, index)
+	p.replicaOf = s.name
+	if s.prepare != nil {
+		if err := s.prepare(p); err != nil {
+			return nil, errors.Wrapf(err, "service %s", p.Name)
+		}
+	}
+	return p, nil
+}
+
+// expandReplicas replaces the awaited replicated services by their instances.
+// The killed ones are resolved by the registry when they are killed, as their instances change with the scales.
+func expandReplicas(processes map[string]*process, sets map[string]*replicaSet) {
+	names := func(name string) []string {
+		set, ok := sets[name]
+		if !ok {
+			return []string{name}
+		}
+
+		var names []string
+		for i := 1; i <= set.replicas; i++ {
+			names = append(names, replicaName(name, i))
+		}
+		return names
+	}
+
+	for _, p := range processes {
+		var wait []*waitCondition
+		for _, c := range p.Hooks.Wait {
+			for _, name := range names(c.Service) {
+				replica := *c
+				replica.Service = name
+				wait = append(wait, &replica)
+			}
+		}
+		p.Hooks.Wait = wait
+	}
+}
+
+// scale starts or stops instances of the given replicated service to reach the given number of replicas.
+// The instances with the highest indexes are stopped first.
+func (p *processor) scale(name string, replicas int) error {
+	if replicas < 0 {
+		return errors.New("negative number of replicas")
+	}
+
+	set, ok := p.reg.replicaSet(name)
+	if !ok {
+		return errors.Errorf("%s is not a replicated service", name)
+	}
+
+	// The scales of the same service are serialized until their replicas are stopped
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	p.m.Lock()
+	if p.termination {
+		p.m.Unlock()
+		return errors.New("composer is shutting down")
+	}
+
+	for i := set.replicas + 1; i <= replicas; i++ {
+		proc, err := set.replica(i)
+		if err != nil {
+			p.m.Unlock()
+			return err
+		}
+
+		p.reg.register(proc)
+		proc.update(p.reg.status()) // the awaited services may already be running or stopped
+		p.start(proc)
+		set.replicas = i
+	}
+
+	var stopping []*process
+	for i := set.replicas; i > replicas; i-- {
+		proc, status := p.reg.getProcess(replicaName(name, i))
+		proc.mu.Lock()
+		proc.retired = true
+		proc.mu.Unlock()
+
+		if status == "stopped" {
+			p.reg.unregister(proc)
+		} else {
+			stopping = append(stopping, proc) // unregistered once stopped
+		}
+		set.replicas = i - 1
+	}
+	p.m.Unlock()
+
+	// The pre_stop hooks must not hold the processor
+	stopAll(stopping, p.stop)
+	for _, proc := range stopping {
+		<-proc.Done
+	}
+
+	p.log.WithPrefixName("processor").Info(fmt.Sprintf("%s scaled to %d", name, replicas))
+	return nil
+}
+
+// isRetired tells whether the process has been stopped by a scale down.
+func (p *process) isRetired() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.retired
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+import "github.com/pkg/errors"
+
+func execWithRlimits(_ map[string]uint64, _ string, _ []string, _ []string) error {
+	return errors.New("rlimits are only supported on Linux and macOS")
+}
@@ -0,0 +1,37 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"math"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+var rlimitResources = map[string]int{
+	"nofile": unix.RLIMIT_NOFILE,
+	"nproc":  unix.RLIMIT_NPROC,
+	"core":   unix.RLIMIT_CORE,
+}
+
+// execWithRlimits replaces composer by the given command once the rlimits are set.
+func execWithRlimits(rlimits map[string]uint64, path string, argv []string, env []string) error {
+	for name, value := range rlimits {
+		resource, ok := rlimitResources[name]
+		if !ok {
+			return errors.Errorf("unknown rlimit %s", name)
+		}
+
+		if value == math.MaxUint64 {
+			value = unix.RLIM_INFINITY
+		}
+
+		if err := unix.Setrlimit(resource, &unix.Rlimit{Cur: value, Max: value}); err != nil {
+			return errors.Wrapf(err, "could not set %s rlimit", name)
+		}
+	}
+
+	return syscall.Exec(path, argv, env)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// A schedule is a cron expression (minute hour day-of-month month day-of-week)
+// or one of the @hourly, @daily, @weekly, @monthly, @yearly and @every <duration> shortcuts.
+type schedule struct {
+	spec   string
+	every  time.Duration
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDay bool // day-of-month or day-of-week is a wildcard, both must match
+}
+
+var scheduleShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func (s *schedule) UnmarshalYAML(value *yaml.Node) error {
+	var spec string
+	if err := value.Decode(&spec); err != nil {
+		return err
+	}
+
+	sched, err := parseSchedule(spec)
+	if err != nil {
+		return errors.Wrapf(err, "line %d: invalid schedule %q", value.Line, spec)
+	}
+
+	*s = *sched
+	return nil
+}
+
+func (s *schedule) String() string {
+	return s.spec
+}
+
+func parseSchedule(spec string) (*schedule, error) {
+	s := &schedule{spec: spec}
+
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			return nil, err
+		}
+		if every <= 0 {
+			return nil, errors.New("period must be positive")
+		}
+
+		s.every = every
+		return s, nil
+	}
+
+	if expr, ok := scheduleShortcuts[spec]; ok {
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New("expected 5 fields")
+	}
+
+	var err error
+	for i, f := range []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	} {
+		*f.bits, err = parseScheduleField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Sunday is either 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.anyDay = fields[2] == "*" || fields[4] == "*"
+
+	return s, nil
+}
+
+// parseScheduleField returns the bit set of the values matched by the field.
+func parseScheduleField(field string, min, max int) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(field, ",") {
+		expr, step, hasStep := strings.Cut(part, "/")
+
+		lo, hi := min, max
+		switch {
+		case expr == "*":
+		case strings.Contains(expr, "-"):
+			from, to, _ := strings.Cut(expr, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, errors.Errorf("invalid range %s", expr)
+			}
+			if hi, err = strconv.Atoi(to); err != nil {
+				return 0, errors.Errorf("invalid range %s", expr)
+			}
+		default:
+			n, err := strconv.Atoi(expr)
+			if err != nil {
+				return 0, errors.Errorf("invalid value %s", expr)
+			}
+			lo, hi = n, n
+			if hasStep {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, errors.Errorf("%s out of range [%d-%d]", expr, min, max)
+		}
+
+		n := 1
+		if hasStep {
+			var err error
+			n, err = strconv.Atoi(step)
+			if err != nil || n <= 0 {
+				return 0, errors.Errorf("invalid step %s", step)
+			}
+		}
+
+		for i := lo; i <= hi; i += n {
+			set |= 1 << i
+		}
+	}
+
+	return set, nil
+}
+
+// next returns the first time matching the schedule after the given one.
+func (s *schedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0) // Impossible dates like February 30
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<t.Hour()) == 0:
+			// Truncate works on the absolute time, it would not land on the hour with half-hour offsets
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s *schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<t.Weekday()) != 0
+
+	if s.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// runScheduled runs the command on each schedule occurrence until the context is done.
+// A failed run is logged and never stops the process.
+func (p *process) runScheduled(ctx context.Context, command func(ctx context.Context) error) error {
+	log := p.Logger.WithPrefixName(p.PaddedName)
+
+	// An occurrence is skipped when the previous run is still in progress,
+	// unless the policy allows it to be queued
+	var triggers chan time.Time
+	switch p.ConcurrencyPolicy {
+	case "queue":
+		triggers = make(chan time.Time, 1)
+	default:
+		triggers = make(chan time.Time)
+	}
+
+	go func() {
+		for {
+			next := p.Schedule.next(time.Now())
+			if next.IsZero() {
+				log.Warn(fmt.Sprintf("schedule %q never occurs", p.Schedule))
+				return
+			}
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			select {
+			case triggers <- next:
+			default:
+				log.Warn("previous run still in progress, skipped the run of ", next.Format(time.TimeOnly))
+			}
+		}
+	}()
+
+	log.Info(fmt.Sprintf("scheduled %q", p.Schedule))
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-triggers:
+		}
+
+		if err := command(ctx); err != nil && ctx.Err() == nil {
+			log.Error("scheduled run failed: ", err)
+		}
+	}
+}
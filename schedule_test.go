@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "@every -1s", "a * * * *"} {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip(err)
+	}
+	date := func(loc *time.Location, year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, loc)
+	}
+
+	tests := []struct {
+		spec string
+		from time.Time
+		next time.Time
+	}{
+		// 2026-01-01 is a Thursday
+		{"* * * * *", date(time.UTC, 2026, 1, 1, 10, 0), date(time.UTC, 2026, 1, 1, 10, 1)},
+		{"@hourly", date(time.UTC, 2026, 1, 1, 10, 0), date(time.UTC, 2026, 1, 1, 11, 0)},
+		{"@daily", date(time.UTC, 2026, 1, 1, 10, 0), date(time.UTC, 2026, 1, 2, 0, 0)},
+		{"@every 90s", date(time.UTC, 2026, 1, 1, 10, 0), date(time.UTC, 2026, 1, 1, 10, 0).Add(90 * time.Second)},
+		{"0 11 * * *", date(kolkata, 2026, 1, 1, 10, 0), date(kolkata, 2026, 1, 1, 11, 0)},
+		{"30 9-17 * * *", date(kolkata, 2026, 1, 1, 17, 45), date(kolkata, 2026, 1, 2, 9, 30)},
+		// Ranges
+		{"0 9-17 * * 1-5", date(time.UTC, 2026, 1, 2, 18, 0), date(time.UTC, 2026, 1, 5, 9, 0)},
+		{"15,45 * * * *", date(time.UTC, 2026, 1, 1, 10, 20), date(time.UTC, 2026, 1, 1, 10, 45)},
+		// Steps
+		{"*/15 * * * *", date(time.UTC, 2026, 1, 1, 10, 16), date(time.UTC, 2026, 1, 1, 10, 30)},
+		{"10/20 * * * *", date(time.UTC, 2026, 1, 1, 10, 51), date(time.UTC, 2026, 1, 1, 11, 10)},
+		{"0 0-12/6 * * *", date(time.UTC, 2026, 1, 1, 7, 0), date(time.UTC, 2026, 1, 1, 12, 0)},
+		// Day-of-month and day-of-week are OR-ed when both are restricted, AND-ed otherwise
+		{"0 0 13 * 5", date(time.UTC, 2026, 1, 1, 10, 0), date(time.UTC, 2026, 1, 2, 0, 0)},
+		{"0 0 13 * 5", date(time.UTC, 2026, 1, 10, 10, 0), date(time.UTC, 2026, 1, 13, 0, 0)},
+		{"0 0 13 * *", date(time.UTC, 2026, 1, 1, 10, 0), date(time.UTC, 2026, 1, 13, 0, 0)},
+		{"0 0 * * 7", date(time.UTC, 2026, 1, 1, 10, 0), date(time.UTC, 2026, 1, 4, 0, 0)},
+		// Impossible date
+		{"0 0 30 2 *", date(time.UTC, 2026, 1, 1, 10, 0), time.Time{}},
+	}
+
+	for _, test := range tests {
+		s, err := parseSchedule(test.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", test.spec, err)
+		}
+
+		if next := s.next(test.from); !next.Equal(test.next) {
+			t.Errorf("%q from %s: got %s, expected %s", test.spec, test.from, next, test.next)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// parseSignal returns the signal for the given name, only INT and KILL are supported on Windows.
+func parseSignal(name string) (os.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "INT":
+		return os.Interrupt, nil
+	case "KILL":
+		return os.Kill, nil
+	default:
+		return nil, errors.Errorf("unsupported signal %s on Windows", name)
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Sink types
+const (
+	sinkSyslog   = "syslog"
+	sinkJournald = "journald"
+)
+
+const defaultJournaldSocket = "/run/systemd/journal/socket"
+
+// The delays between the reconnection attempts to the syslog daemon.
+const (
+	syslogMinBackoff = time.Second
+	syslogMaxBackoff = 30 * time.Second
+)
+
+// The usual local syslog sockets.
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// sinkSettings defines a log sink receiving the lines along the terminal.
+type sinkSettings struct {
+	Type     string `yaml:"type"`     // syslog or journald
+	Address  string `yaml:"address"`  // socket path, the usual one when empty
+	Facility string `yaml:"facility"` // syslog only, user by default
+
+	facility int
+}
+
+func (s *sinkSettings) UnmarshalYAML(value *yaml.Node) error {
+	type plain sinkSettings
+	if err := value.Decode((*plain)(s)); err != nil {
+		return err
+	}
+
+	switch s.Type {
+	case sinkSyslog:
+		if s.Facility == "" {
+			s.Facility = "user"
+		}
+
+		var ok bool
+		if s.facility, ok = syslogFacilities[s.Facility]; !ok {
+			return errors.Errorf("line %d: unsupported syslog facility %s", value.Line, s.Facility)
+		}
+	case sinkJournald:
+	default:
+		return errors.Errorf("line %d: unsupported log sink %q", value.Line, s.Type)
+	}
+
+	return nil
+}
+
+// A sinkRecord is a line sent to the sinks.
+type sinkRecord struct {
+	time       time.Time
+	identifier string // service name
+	stream     string // stdout, stderr or composer
+	level      level
+	message    []byte
+}
+
+type sink interface {
+	send(r *sinkRecord) error
+	Close() error
+}
+
+// sinks holds the log sinks, shared by all the loggers.
+type sinks struct {
+	mu   sync.RWMutex
+	list []sink
+}
+
+// open connects to the sinks defined in the settings.
+func (s *sinks) open(settings []*sinkSettings, project string) error {
+	var list []sink
+	for _, cfg := range settings {
+		var (
+			sk  sink
+			err error
+		)
+		switch cfg.Type {
+		case sinkSyslog:
+			sk, err = dialSyslog(cfg.Address, cfg.facility)
+		case sinkJournald:
+			sk, err = dialJournald(cfg.Address, project)
+		}
+		if err != nil {
+			for _, sk := range list {
+				sk.Close() //nolint: errcheck
+			}
+			return errors.Wrapf(err, "%s sink", cfg.Type)
+		}
+
+		list = append(list, sk)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.list = list
+	return nil
+}
+
+// send sends the record to all the sinks, the errors are ignored.
+func (s *sinks) send(r *sinkRecord) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, sk := range s.list {
+		sk.send(r) //nolint: errcheck
+	}
+}
+
+func (s *sinks) enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.list) != 0
+}
+
+func (s *sinks) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sk := range s.list {
+		sk.Close() //nolint: errcheck
+	}
+	s.list = nil
+	return nil
+}
+
+// sink sends the message to the log sinks, the ANSI sequences are removed.
+// The records without level get the default level of their stream.
+func (l *logger) sink(stream string, lvl level, msg []byte) {
+	if l.sinks == nil || !l.sinks.enabled() {
+		return
+	}
+
+	if lvl == levelUnknown {
+		lvl = levelInfo
+		if stream == "stderr" {
+			lvl = levelError
+		}
+	}
+
+	identifier := "composer"
+	if len(l.names) != 0 {
+		identifier = l.names[0]
+	}
+
+	l.sinks.send(&sinkRecord{
+		time:       time.Now(),
+		identifier: identifier,
+		stream:     stream,
+		level:      lvl,
+		message:    ansi.ReplaceAll(msg, nil),
+	})
+}
+
+// severity returns the syslog severity of the level.
+func (l level) severity() int {
+	switch l {
+	case levelFatal:
+		return 2 // critical
+	case levelError:
+		return 3
+	case levelWarn:
+		return 4
+	case levelDebug, levelTrace:
+		return 7
+	default:
+		return 6 // informational
+	}
+}
+
+// ----------------
+// -------------
+// Syslog
+// -----
+// ---
+
+// syslogSink sends the records in the RFC 5424 format to the local syslog.
+type syslogSink struct {
+	address  string
+	facility int
+	hostname string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	network string
+	retry   time.Time     // no reconnection before, while the daemon is down
+	backoff time.Duration // between the reconnection attempts
+}
+
+func dialSyslog(address string, facility int) (*syslogSink, error) {
+	s := &syslogSink{
+		address:  address,
+		facility: facility,
+		hostname: "-",
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		s.hostname = hostname
+	}
+
+	return s, s.connect()
+}
+
+func (s *syslogSink) connect() error {
+	addresses := syslogSockets
+	if s.address != "" {
+		addresses = []string{s.address}
+	}
+
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, address := range addresses {
+			conn, err := net.Dial(network, address)
+			if err == nil {
+				s.conn = conn
+				s.network = network
+				return nil
+			}
+		}
+	}
+
+	return errors.New("could not connect to the local syslog")
+}
+
+func (s *syslogSink) send(r *sinkRecord) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %d %s - ", //nolint: errcheck
+		s.facility*8+r.level.severity(),
+		r.time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname,
+		syslogName(r.identifier),
+		os.Getpid(),
+		r.stream,
+	)
+	buf.Write(r.message) //nolint: errcheck
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The syslog daemon may have been restarted
+	if s.conn == nil || s.write(buf.Bytes()) != nil {
+		if time.Now().Before(s.retry) {
+			return errors.New("local syslog is unavailable")
+		}
+
+		if err := s.connect(); err != nil {
+			s.backoff = min(max(2*s.backoff, syslogMinBackoff), syslogMaxBackoff)
+			s.retry = time.Now().Add(s.backoff)
+			return err
+		}
+		s.backoff = 0
+		return s.write(buf.Bytes())
+	}
+	return nil
+}
+
+// write sends the message, stream sockets need a trailing newline as frame delimiter.
+func (s *syslogSink) write(p []byte) error {
+	if s.network == "unix" {
+		p = append(p[:len(p):len(p)], '\n')
+	}
+
+	_, err := s.conn.Write(p)
+	if err != nil {
+		s.conn.Close() //nolint: errcheck
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// syslogName returns the name as a RFC 5424 APP-NAME, printable ASCII up to 48 characters.
+func syslogName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < '!' || r > '~' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	if len(name) > 48 {
+		name = name[:48]
+	}
+	return name
+}
+
+// ----------------
+// -------------
+// Journald
+// -----
+// ---
+
+// journaldSink sends the records to systemd-journald with its native protocol.
+type journaldSink struct {
+	project string
+	conn    net.Conn
+}
+
+func dialJournald(address, project string) (*journaldSink, error) {
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("journald is only available on Linux")
+	}
+
+	if address == "" {
+		address = defaultJournaldSocket
+	}
+
+	conn, err := net.Dial("unixgram", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &journaldSink{
+		project: project,
+		conn:    conn,
+	}, nil
+}
+
+func (s *journaldSink) send(r *sinkRecord) error {
+	var buf bytes.Buffer
+	journaldField(&buf, "MESSAGE", r.message)
+	journaldField(&buf, "PRIORITY", []byte(fmt.Sprint(r.level.severity())))
+	journaldField(&buf, "SYSLOG_IDENTIFIER", []byte(r.identifier))
+	journaldField(&buf, "COMPOSER_STREAM", []byte(r.stream))
+	journaldField(&buf, "COMPOSER_PROJECT", []byte(s.project))
+
+	return s.write(buf.Bytes())
+}
+
+func (s *journaldSink) Close() error {
+	return s.conn.Close()
+}
+
+// journaldField writes a field of the native protocol, the values with newlines are serialized as binary data.
+func journaldField(buf *bytes.Buffer, name string, value []byte) {
+	if !bytes.ContainsRune(value, '\n') {
+		fmt.Fprintf(buf, "%s=%s\n", name, value) //nolint: errcheck
+		return
+	}
+
+	buf.WriteString(name + "\n")                               //nolint: errcheck
+	binary.Write(buf, binary.LittleEndian, uint64(len(value))) //nolint: errcheck
+	buf.Write(value)                                           //nolint: errcheck
+	buf.WriteByte('\n')                                        //nolint: errcheck
+}
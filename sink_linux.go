@@ -0,0 +1,51 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// write sends the datagram to journald.
+// A datagram too large for the socket is passed in a sealed memfd, as journald expects.
+func (s *journaldSink) write(p []byte) error {
+	_, err := s.conn.Write(p)
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return err
+	}
+
+	fd, err := unix.MemfdCreate("composer-journal", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return err
+	}
+	f := os.NewFile(uintptr(fd), "composer-journal")
+	defer f.Close()
+
+	if _, err = f.Write(p); err != nil {
+		return err
+	}
+
+	seals := unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE | unix.F_SEAL_SEAL
+	if _, err = unix.FcntlInt(uintptr(fd), unix.F_ADD_SEALS, seals); err != nil {
+		return err
+	}
+
+	// The net package refuses the ancillary data on a connected datagram socket
+	raw, err := s.conn.(*net.UnixConn).SyscallConn()
+	if err != nil {
+		return err
+	}
+	cerr := raw.Write(func(sfd uintptr) bool {
+		err = unix.Sendmsg(int(sfd), nil, unix.UnixRights(fd), nil, 0)
+		return err != unix.EAGAIN
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+func (s *journaldSink) write(p []byte) error {
+	_, err := s.conn.Write(p)
+	return err
+}
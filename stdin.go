@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A stdinMux forwards the composer's input to one service at a time.
+// A line `@name` attaches the input to the given service and `@` detaches it,
+// `@@` at the beginning of a line is forwarded as `@`.
+type stdinMux struct {
+	log *logger
+
+	mu       sync.Mutex
+	inputs   map[string]*input
+	attached string
+}
+
+type input struct {
+	r *os.File
+	w *os.File
+}
+
+func newStdinMux(log *logger) *stdinMux {
+	return &stdinMux{
+		log:    log.WithPrefixName("stdin"),
+		inputs: make(map[string]*input),
+	}
+}
+
+// open returns the input of the given service.
+// The first opened input is attached.
+func (m *stdinMux) open(name string) io.Reader {
+	r, w, err := os.Pipe()
+	if err != nil {
+		m.log.Error(err)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inputs[name] = &input{r: r, w: w}
+	if m.attached == "" {
+		m.attach(name)
+	}
+
+	return r
+}
+
+func (m *stdinMux) close(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	in, ok := m.inputs[name]
+	if !ok {
+		return
+	}
+
+	in.w.Close() //nolint: errcheck
+	in.r.Close() //nolint: errcheck
+	delete(m.inputs, name)
+
+	if m.attached == name {
+		m.attached = ""
+		m.log.Warn("detached from ", name)
+	}
+}
+
+// attach must be called with the lock held.
+func (m *stdinMux) attach(name string) {
+	if name == "" {
+		if m.attached != "" {
+			m.log.Info("detached from ", m.attached)
+		}
+		m.attached = ""
+		return
+	}
+
+	if _, ok := m.inputs[name]; !ok {
+		names := make([]string, 0, len(m.inputs))
+		for name := range m.inputs {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		m.log.Warn(name, " cannot receive input, available: ", strings.Join(names, ", "))
+		return
+	}
+
+	m.attached = name
+	m.log.Info("attached to ", name)
+}
+
+// forward reads the given input line by line until its end.
+func (m *stdinMux) forward(r io.Reader) {
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			m.dispatch(line)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (m *stdinMux) dispatch(line string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(line, "@@"):
+		line = line[1:]
+	case strings.HasPrefix(line, "@"):
+		m.attach(strings.TrimSpace(line[1:]))
+		return
+	}
+
+	in, ok := m.inputs[m.attached]
+	if !ok {
+		m.log.Warn("no service attached, use @name to attach one")
+		return
+	}
+
+	// Do not block all the inputs on a service not reading its input
+	in.w.SetWriteDeadline(time.Now().Add(time.Second)) //nolint: errcheck
+	if _, err := io.WriteString(in.w, line); err != nil {
+		m.log.Warn(m.attached, " is not reading its input: ", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// resolveTasks returns the given tasks and all their dependencies, dependencies first.
+func resolveTasks(tasks map[string]*process, names ...string) ([]*process, error) {
+	var (
+		order    []*process
+		visiting = make(map[string]bool)
+		visited  = make(map[string]bool)
+		visit    func(name string, path []string) error
+	)
+
+	visit = func(name string, path []string) error {
+		if visited[name] {
+			return nil
+		}
+		if visiting[name] {
+			return errors.Errorf("task dependency cycle: %v", append(path, name))
+		}
+
+		t, ok := tasks[name]
+		if !ok {
+			return errors.Errorf("unknown task %s", name)
+		}
+
+		visiting[name] = true
+		for _, dep := range t.Deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		visited[name] = true
+
+		order = append(order, t)
+		return nil
+	}
+
+	slices.Sort(names) // Stable order for map based inputs
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// runTasks runs sequentially the given tasks and stops on the first failure.
+func runTasks(ctx context.Context, tasks []*process) error {
+	template := fmt.Sprintf("%%%ds", getPadding(tasks, nil))
+
+	for _, t := range tasks {
+		t.PaddedName = fmt.Sprintf(template, t.Name)
+
+		if err := t.run(ctx); err != nil {
+			return errors.Wrapf(err, "task %s failed", t.Name)
+		}
+	}
+
+	return nil
+}
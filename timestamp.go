@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Timestamp formats
+const (
+	timestampRFC3339  = "rfc3339"
+	timestampTime     = "time"
+	timestampRelative = "relative" // since composer started
+	timestampDelta    = "delta"    // since the previous line
+)
+
+// A clock timestamps the log lines.
+type clock struct {
+	format string
+	start  time.Time
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func newClock(format string) (*clock, error) {
+	switch format {
+	case "true":
+		format = timestampTime
+	case timestampRFC3339, timestampTime, timestampRelative, timestampDelta:
+	default:
+		return nil, errors.Errorf("unsupported timestamps format %s", format)
+	}
+
+	now := time.Now()
+	return &clock{
+		format: format,
+		start:  now,
+		last:   now,
+	}, nil
+}
+
+// stamp returns the timestamp of a line logged now.
+func (c *clock) stamp() string {
+	now := time.Now()
+
+	switch c.format {
+	case timestampRFC3339:
+		return now.Format("2006-01-02T15:04:05.000Z07:00")
+	case timestampRelative:
+		return fmt.Sprintf("+%8.3fs", now.Sub(c.start).Seconds())
+	case timestampDelta:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		d := now.Sub(c.last)
+		c.last = now
+		return fmt.Sprintf("+%6.3fs", d.Seconds())
+	default:
+		return now.Format("15:04:05.000")
+	}
+}
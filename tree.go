@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// terminate interrupts the process group of the given process
+// and kills the remaining members once the timeout is reached.
+func (p *process) terminate(process *os.Process, timeout time.Duration) {
+	if timeout <= 0 || runtime.GOOS == "windows" {
+		signalGroup(process, os.Kill) //nolint: errcheck
+		return
+	}
+
+	signalGroup(process, os.Interrupt) //nolint: errcheck
+
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		if !groupAlive(process) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	p.killStragglers(process)
+
+	p.mu.Lock()
+	delete(p.groups, process) // Already cleaned up
+	p.mu.Unlock()
+}
+
+// cleanupGroups kills all the members left in the process groups created by the process.
+func (p *process) cleanupGroups() {
+	p.mu.Lock()
+	groups := make([]*os.Process, 0, len(p.groups))
+	for process := range p.groups {
+		groups = append(groups, process)
+	}
+	p.mu.Unlock()
+
+	for _, process := range groups {
+		p.killStragglers(process)
+
+		p.mu.Lock()
+		delete(p.groups, process)
+		p.mu.Unlock()
+	}
+}
+
+func (p *process) killStragglers(process *os.Process) {
+	if !groupAlive(process) {
+		return
+	}
+
+	members := groupMembers(process.Pid)
+	signalGroup(process, os.Kill) //nolint: errcheck
+
+	msg := fmt.Sprintf("process group %d did not stop, killed", process.Pid)
+	if len(members) != 0 {
+		msg += ": " + strings.Join(members, ", ")
+	}
+	p.Logger.WithPrefixName(p.PaddedName).Warn(msg)
+}
+
+// ----------------
+// -------------
+// Orphans
+// -----
+// ---
+
+// An orphan is a process reparented to composer as subreaper.
+type orphan struct {
+	pid    int
+	name   string
+	zombie bool
+}
+
+func (o orphan) String() string {
+	return fmt.Sprintf("%d (%s)", o.pid, o.name)
+}
+
+// reapOrphans periodically reaps the exited orphans.
+// The commands are tracked from their start until os/exec has reaped them, so the tracked zombies are never reaped here.
+// A zombie is reaped only when seen twice, leaving time to os/exec to reap its own children.
+func (p *processor) reapOrphans(done <-chan struct{}) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var seen []int
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		spawning.Lock()
+		var zombies []int
+		for _, o := range orphans(p.trackedPids()) {
+			if !o.zombie {
+				continue
+			}
+
+			if slices.Contains(seen, o.pid) {
+				reap(o.pid)
+				continue
+			}
+			zombies = append(zombies, o.pid)
+		}
+		spawning.Unlock()
+		seen = zombies
+	}
+}
+
+// killOrphans kills the orphans along with their process group.
+// Their own children are adopted in turn by composer, so it is repeated until no orphan is left.
+func (p *processor) killOrphans() {
+	var killed []string
+
+	for range 10 {
+		found := orphans(p.trackedPids())
+		if len(found) == 0 {
+			break
+		}
+
+		for _, o := range found {
+			if !o.zombie {
+				killed = append(killed, o.String())
+
+				if process, err := os.FindProcess(o.pid); err == nil {
+					signalGroup(process, os.Kill) //nolint: errcheck
+				}
+			}
+			reap(o.pid)
+		}
+	}
+
+	if len(killed) != 0 {
+		p.log.WithPrefixName("processor").Warn("killed orphans: ", strings.Join(killed, ", "))
+	}
+}
+
+func (p *processor) trackedPids() []int {
+	var pids []int
+	for _, process := range p.reg.processes() {
+		process.mu.Lock()
+		for child := range process.children {
+			pids = append(pids, child.Pid)
+		}
+		process.mu.Unlock()
+	}
+	return pids
+}
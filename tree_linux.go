@@ -0,0 +1,120 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// setSubreaper makes composer adopt the orphans of its descendants.
+func setSubreaper() error {
+	return unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+}
+
+type procStat struct {
+	pid     int
+	comm    string
+	state   byte
+	ppid    int
+	pgrp    int
+	ticks   uint64 // user and system CPU time
+	threads int
+	rss     uint64 // pages
+}
+
+// procStats returns the status of all the processes from /proc.
+func procStats() []procStat {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	var stats []procStat
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			continue // Vanished
+		}
+
+		// pid (comm) state ppid pgrp session tty_nr tpgid flags minflt cminflt majflt cmajflt utime stime
+		// cutime cstime priority nice num_threads itrealvalue starttime vsize rss ...
+		i := bytes.IndexByte(data, '(')
+		j := bytes.LastIndexByte(data, ')')
+		if i < 0 || j < i {
+			continue
+		}
+
+		fields := bytes.Fields(data[j+1:])
+		if len(fields) < 22 {
+			continue
+		}
+
+		stat := procStat{
+			pid:   pid,
+			comm:  string(data[i+1 : j]),
+			state: fields[0][0],
+		}
+		stat.ppid, _ = strconv.Atoi(string(fields[1]))
+		stat.pgrp, _ = strconv.Atoi(string(fields[2]))
+		utime, _ := strconv.ParseUint(string(fields[11]), 10, 64)
+		stime, _ := strconv.ParseUint(string(fields[12]), 10, 64)
+		stat.ticks = utime + stime
+		stat.threads, _ = strconv.Atoi(string(fields[17]))
+		stat.rss, _ = strconv.ParseUint(string(fields[21]), 10, 64)
+		stats = append(stats, stat)
+	}
+
+	return stats
+}
+
+// groupMembers returns the description of the processes belonging to the given process group.
+func groupMembers(pgid int) []string {
+	var members []string
+	for _, stat := range procStats() {
+		if stat.pgrp == pgid && stat.state != 'Z' {
+			members = append(members, fmt.Sprintf("%d (%s)", stat.pid, stat.comm))
+		}
+	}
+	return members
+}
+
+// groupAlive tells whether the process group led by the given process still has running members.
+func groupAlive(process *os.Process) bool {
+	return len(groupMembers(process.Pid)) != 0
+}
+
+// orphans returns the children of composer not started by composer itself.
+func orphans(tracked []int) []orphan {
+	self := os.Getpid()
+
+	var found []orphan
+	for _, stat := range procStats() {
+		if stat.ppid != self || slices.Contains(tracked, stat.pid) {
+			continue
+		}
+
+		found = append(found, orphan{
+			pid:    stat.pid,
+			name:   stat.comm,
+			zombie: stat.state == 'Z',
+		})
+	}
+	return found
+}
+
+// reap waits for the given child to exit and releases it.
+func reap(pid int) {
+	var status unix.WaitStatus
+	unix.Wait4(pid, &status, 0, nil) //nolint: errcheck
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+func setSubreaper() error {
+	return errors.New("subreaper is only supported on Linux")
+}
+
+// groupAlive tells whether the process group led by the given process still has members.
+func groupAlive(process *os.Process) bool {
+	return signalGroup(process, syscall.Signal(0)) == nil
+}
+
+func groupMembers(_ int) []string {
+	return nil
+}
+
+func orphans(_ []int) []orphan {
+	return nil
+}
+
+func reap(_ int) {}
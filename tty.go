@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+// flushTimeout is the time left to forward the remaining output of a terminal
+// still opened by a background process once the command has exited.
+const flushTimeout = time.Second
+
+type winsize struct {
+	Cols uint16 `yaml:"cols"`
+	Rows uint16 `yaml:"rows"`
+}
+
+// runTTY runs the command attached to a pseudo-terminal whose output is forwarded to stdout.
+// Outputs are merged since the command writes both of them to the terminal.
+func (p *process) runTTY(ctx context.Context, run func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error, stdin io.Reader, stdout io.Writer) error {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return errors.Wrap(err, "could not allocate tty")
+	}
+	defer ptmx.Close()
+
+	size := p.ttySize()
+	if err = pty.Setsize(ptmx, &pty.Winsize{Cols: size.Cols, Rows: size.Rows}); err != nil {
+		tty.Close() //nolint: errcheck
+		return errors.Wrap(err, "could not set tty size")
+	}
+
+	forwarded := make(chan struct{})
+	go func() {
+		io.Copy(stdout, ptmx) //nolint: errcheck // Ends with EIO once the terminal is closed everywhere
+		close(forwarded)
+	}()
+
+	err = run(ctx, stdin, tty, tty)
+	tty.Close() //nolint: errcheck
+
+	select {
+	case <-forwarded:
+	case <-time.After(flushTimeout):
+	}
+
+	return err
+}
+
+// ttySize returns the configured terminal size,
+// defaulting to the composer's terminal width left by the prefix.
+func (p *process) ttySize() winsize {
+	if p.TTYSize != nil {
+		return *p.TTYSize
+	}
+
+	size := winsize{Cols: 80, Rows: 24}
+	if cols, rows, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		size.Cols = uint16(max(cols-len(p.PaddedName)-2, 20)) // prefix is `name: `
+		size.Rows = uint16(rows)
+	}
+
+	return size
+}
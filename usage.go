@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultUsageInterval = 5 * time.Second
+
+// usage is the resource usage of a process tree.
+type usage struct {
+	CPU     float64   `json:"cpu"` // percent of one CPU
+	RSS     uint64    `json:"rss"` // bytes
+	Threads int       `json:"threads"`
+	FDs     int       `json:"fds"`
+	Sampled time.Time `json:"sampled_at"`
+}
+
+func (u usage) String() string {
+	return fmt.Sprintf("cpu=%.1f%% rss=%s threads=%d fds=%d", u.CPU, formatBytes(u.RSS), u.Threads, u.FDs)
+}
+
+type treeSample struct {
+	ticks   uint64
+	rss     uint64
+	threads int
+	fds     int
+}
+
+// sampleUsage updates the resource usage of the process.
+func (p *process) sampleUsage(now time.Time) bool {
+	p.mu.Lock()
+	roots := make([]int, 0, len(p.children))
+	for child := range p.children {
+		roots = append(roots, child.Pid)
+	}
+	groups := make([]int, 0, len(p.groups))
+	for process := range p.groups {
+		groups = append(groups, process.Pid)
+	}
+	p.mu.Unlock()
+
+	sample, ok := sampleTree(roots, groups)
+	if !ok {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	u := usage{
+		RSS:     sample.rss,
+		Threads: sample.threads,
+		FDs:     sample.fds,
+		Sampled: now,
+	}
+	if !p.usage.Sampled.IsZero() && sample.ticks > p.ticks {
+		elapsed := now.Sub(p.usage.Sampled).Seconds()
+		u.CPU = float64(sample.ticks-p.ticks) / clockTicks / elapsed * 100
+	}
+
+	p.usage = u
+	p.ticks = sample.ticks
+
+	return true
+}
+
+func (p *process) currentUsage() usage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.usage
+}
+
+// checkMemory warns once when the process's memory usage grows past its threshold.
+func (p *process) checkMemory() {
+	if p.MemoryWarnThreshold == 0 {
+		return
+	}
+
+	u := p.currentUsage()
+	switch {
+	case u.RSS > uint64(p.MemoryWarnThreshold) && !p.memoryWarned:
+		p.memoryWarned = true
+		p.Logger.WithPrefixName(p.PaddedName).Warn(fmt.Sprintf("memory usage %s exceeds %s", formatBytes(u.RSS), formatBytes(uint64(p.MemoryWarnThreshold))))
+	case u.RSS <= uint64(p.MemoryWarnThreshold):
+		p.memoryWarned = false
+	}
+}
+
+// monitor samples the resource usage of the running processes until done is closed.
+// A summary line is printed every summary period when it is set.
+func (p *processor) monitor(interval, summary time.Duration, done <-chan struct{}) {
+	if interval <= 0 {
+		interval = defaultUsageInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			running := p.reg.runningProcesses()
+			for _, process := range running {
+				if !process.sampleUsage(now) {
+					return // Not supported
+				}
+				process.checkMemory()
+			}
+
+			if summary > 0 && now.Sub(last) >= summary && len(running) != 0 {
+				last = now
+				p.log.WithPrefixName("usage").Info(usageSummary(running))
+			}
+		}
+	}
+}
+
+func usageSummary(processes []*process) string {
+	slices.SortFunc(processes, func(a, b *process) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	parts := make([]string, 0, len(processes))
+	for _, process := range processes {
+		parts = append(parts, process.Name+" "+process.currentUsage().String())
+	}
+	return strings.Join(parts, " | ")
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
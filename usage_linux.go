@@ -0,0 +1,55 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+)
+
+const (
+	clockTicks = 100 // USER_HZ
+)
+
+var pageSize = uint64(os.Getpagesize())
+
+// sampleTree sums the resource usage of the given processes, the members of the given process groups
+// and all their descendants.
+func sampleTree(roots []int, groups []int) (treeSample, bool) {
+	stats := procStats()
+
+	tree := make(map[int]bool)
+	for _, stat := range stats {
+		if slices.Contains(roots, stat.pid) || slices.Contains(groups, stat.pgrp) {
+			tree[stat.pid] = true
+		}
+	}
+
+	// Add descendants until no more process is found
+	for found := true; found; {
+		found = false
+		for _, stat := range stats {
+			if !tree[stat.pid] && tree[stat.ppid] {
+				tree[stat.pid] = true
+				found = true
+			}
+		}
+	}
+
+	var sample treeSample
+	for _, stat := range stats {
+		if !tree[stat.pid] || stat.state == 'Z' {
+			continue
+		}
+
+		sample.ticks += stat.ticks
+		sample.rss += stat.rss * pageSize
+		sample.threads += stat.threads
+		if fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", stat.pid)); err == nil {
+			sample.fds += len(fds)
+		}
+	}
+
+	return sample, true
+}
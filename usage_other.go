@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+const clockTicks = 100
+
+func sampleTree(_ []int, _ []int) (treeSample, bool) {
+	return treeSample{}, false // Not supported
+}
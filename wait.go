@@ -0,0 +1,235 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultWaitLogTimeout = time.Minute
+
+// errAborted is returned by wait when the process has been stopped before being started.
+var errAborted = errors.New("aborted")
+
+// A waitCondition is satisfied when the awaited service is stopped
+// or, when a log pattern is given, as soon as the service outputs a matching line.
+type waitCondition struct {
+	Service string        `yaml:"service"`
+	Log     string        `yaml:"log"`
+	Timeout time.Duration `yaml:"timeout"` // log only
+
+	pattern *regexp.Regexp
+	timer   *time.Timer
+}
+
+func (c *waitCondition) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&c.Service)
+	}
+
+	type plain waitCondition
+	if err := value.Decode((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.Service == "" {
+		return errors.Errorf("line %d: wait condition without service", value.Line)
+	}
+
+	if c.Log != "" {
+		var err error
+		c.pattern, err = regexp.Compile(c.Log)
+		if err != nil {
+			return errors.Wrapf(err, "line %d: invalid wait log pattern", value.Line)
+		}
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = defaultWaitLogTimeout
+	}
+
+	return nil
+}
+
+// A logWatcher notifies when a line matching its pattern is outputted.
+type logWatcher struct {
+	pattern *regexp.Regexp
+	notify  func()
+}
+
+// watchLog registers a function called once the process outputs a line matching the given pattern.
+// It is called right away when the current run has already outputted such a line.
+func (p *process) watchLog(pattern *regexp.Regexp, notify func()) {
+	p.mu.Lock()
+	if p.logged[pattern.String()] {
+		p.mu.Unlock()
+		notify()
+		return
+	}
+
+	p.logWatchers = append(p.logWatchers, &logWatcher{
+		pattern: pattern,
+		notify:  notify,
+	})
+	p.mu.Unlock()
+}
+
+// awaitLog registers the log based wait condition of the process on the awaited process.
+func (p *process) awaitLog(c *waitCondition, awaited *process) {
+	awaited.mu.Lock()
+	awaited.readyPatterns = append(awaited.readyPatterns, c.pattern)
+	awaited.mu.Unlock()
+
+	awaited.watchLog(c.pattern, func() {
+		p.fulfill(c)
+	})
+}
+
+func (p *process) observeLine(line []byte) {
+	if m := setOutput.FindSubmatch(line); m != nil {
+		p.setOutputs(map[string]string{string(m[1]): string(m[2])})
+	}
+
+	var matched []*logWatcher
+
+	p.mu.Lock()
+	p.logWatchers = slices.DeleteFunc(p.logWatchers, func(w *logWatcher) bool {
+		if w.pattern.Match(line) {
+			if p.logged == nil {
+				p.logged = make(map[string]bool)
+			}
+			p.logged[w.pattern.String()] = true
+			matched = append(matched, w)
+			return true
+		}
+		return false
+	})
+	p.mu.Unlock()
+
+	for _, w := range matched {
+		w.notify()
+	}
+}
+
+// wait blocks until all wait conditions are satisfied.
+// It returns an error when the process must not be started.
+func (p *process) wait() error {
+	if p.waiting != nil {
+		<-p.waiting.Done()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.waitErr
+}
+
+func (p *process) notify(status map[string][]string) {
+	p.update(status)
+}
+
+func (p *process) update(status map[string][]string) {
+	if p.waiting == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.waiting.Err() != nil {
+		return // Not waiting anymore
+	}
+
+	var (
+		failed []string
+		err    error
+	)
+	p.Hooks.Wait = slices.DeleteFunc(p.Hooks.Wait, func(c *waitCondition) bool {
+		if c.pattern != nil {
+			if c.timer == nil && slices.Contains(status["running"], c.Service) {
+				// The timeout starts with the awaited service
+				c.timer = time.AfterFunc(c.Timeout, func() {
+					p.mu.Lock()
+					defer p.mu.Unlock()
+
+					if slices.Contains(p.Hooks.Wait, c) {
+						p.stopWaiting(errors.Errorf("%s did not log %q within %s", c.Service, c.Log, c.Timeout))
+					}
+				})
+			}
+
+			if slices.Contains(status["stopped"], c.Service) && err == nil {
+				err = errors.Errorf("%s stopped without logging %q", c.Service, c.Log)
+			}
+			return false
+		}
+
+		if !slices.Contains(status["stopped"], c.Service) {
+			return false
+		}
+
+		if p.awaitSuccess[c.Service] && !slices.Contains(status["succeeded"], c.Service) {
+			failed = append(failed, c.Service)
+		}
+
+		// delete any stopped process from waiting list
+		return true
+	})
+
+	if len(failed) != 0 {
+		p.Logger.WithPrefixName(p.PaddedName).Warn("not started, awaited task failed: ", strings.Join(failed, ", "))
+		p.stopWaiting(errAborted)
+		return
+	}
+
+	if err != nil {
+		p.stopWaiting(err)
+		return
+	}
+
+	if len(p.Hooks.Wait) == 0 {
+		p.doneWaiting()
+	}
+}
+
+// fulfill removes the given condition from the waiting list.
+func (p *process) fulfill(c *waitCondition) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := slices.Index(p.Hooks.Wait, c)
+	if i < 0 {
+		return
+	}
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	p.Hooks.Wait = slices.Delete(p.Hooks.Wait, i, i+1)
+
+	if len(p.Hooks.Wait) == 0 {
+		p.doneWaiting()
+	}
+}
+
+// stopWaiting releases the process with the given reason.
+// The process's lock must be held.
+func (p *process) stopWaiting(err error) {
+	if p.waitErr == nil {
+		p.waitErr = err
+	}
+
+	for _, c := range p.Hooks.Wait {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+	}
+
+	if p.doneWaiting != nil {
+		p.doneWaiting()
+	}
+}
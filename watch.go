@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultWatchDebounce = 300 * time.Millisecond
+
+// A watch triggers an action on the process when the watched files change.
+type watch struct {
+	Paths    []string      `yaml:"paths"`   // default to the process working directory
+	Include  []string      `yaml:"include"` // all files when empty
+	Exclude  []string      `yaml:"exclude"`
+	Debounce time.Duration `yaml:"debounce"`
+	Action   string        `yaml:"action"` // restart, signal or sync
+	Signal   string        `yaml:"signal"`
+	Sync     *hook         `yaml:"sync"`
+
+	signal os.Signal
+}
+
+func (w *watch) UnmarshalYAML(value *yaml.Node) error {
+	type plain watch
+	if err := value.Decode((*plain)(w)); err != nil {
+		return err
+	}
+
+	if w.Debounce <= 0 {
+		w.Debounce = defaultWatchDebounce
+	}
+
+	switch w.Action {
+	case "":
+		w.Action = "restart"
+	case "restart":
+	case "signal":
+		if w.Signal == "" {
+			w.Signal = "HUP"
+		}
+
+		var err error
+		w.signal, err = parseSignal(w.Signal)
+		if err != nil {
+			return errors.Wrapf(err, "line %d", value.Line)
+		}
+	case "sync":
+		if w.Sync == nil {
+			return errors.Errorf("line %d: watch sync action without sync command", value.Line)
+		}
+	default:
+		return errors.Errorf("line %d: unsupported watch action %s", value.Line, w.Action)
+	}
+
+	for _, pattern := range slices.Concat(w.Include, w.Exclude) {
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return errors.Wrapf(err, "line %d: invalid watch pattern %s", value.Line, pattern)
+		}
+	}
+
+	return nil
+}
+
+// skip tells whether the given path, relative to a watched root, must be ignored.
+func (w *watch) skip(name string, dir bool) bool {
+	name = filepath.ToSlash(name)
+	for _, pattern := range w.Exclude {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+
+	if dir || len(w.Include) == 0 {
+		return false
+	}
+
+	for _, pattern := range w.Include {
+		if matchGlob(pattern, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// watchChanges performs the watch action each time the watched files change until the context is done.
+func (p *process) watchChanges(ctx context.Context) {
+	log := p.Logger.WithPrefixName(p.PaddedName)
+
+	workdir, err := p.workdir()
+	if err != nil {
+		log.Error("watch: ", err)
+		return
+	}
+
+	roots := make([]string, 0, len(p.Watch.Paths))
+	for _, root := range p.Watch.Paths {
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(workdir, root)
+		}
+		roots = append(roots, root)
+	}
+	if len(roots) == 0 {
+		roots = append(roots, workdir)
+	}
+
+	changes := make(chan string, 64)
+	go func() {
+		if err := watchFiles(ctx, roots, p.Watch.skip, changes); err != nil {
+			log.Error("watch: ", err)
+		}
+	}()
+
+	var (
+		changed []string
+		timer   = time.NewTimer(0)
+	)
+	<-timer.C
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case name := <-changes:
+			if !slices.Contains(changed, name) {
+				changed = append(changed, name)
+			}
+			timer.Reset(p.Watch.Debounce)
+		case <-timer.C:
+			if len(changed) == 1 {
+				log.Warn(fmt.Sprintf("%s changed, %s", changed[0], p.Watch.Action))
+			} else {
+				log.Warn(fmt.Sprintf("%s and %d other files changed, %s", changed[0], len(changed)-1, p.Watch.Action))
+			}
+			changed = changed[:0]
+
+			switch p.Watch.Action {
+			case "restart":
+				select {
+				case p.restarts <- struct{}{}:
+				default: // Restart already requested
+				}
+			case "signal":
+				p.signal(p.Watch.signal)
+			case "sync":
+				if err := p.runHook(ctx, "sync", p.Watch.Sync); err != nil && ctx.Err() == nil {
+					log.Error(err)
+				}
+			}
+		}
+	}
+}
+
+// runRestartable runs the command and restarts it on each request until the context is done.
+// The command is not restarted when it exits by itself, it waits the next change.
+func (p *process) runRestartable(ctx context.Context, command func(ctx context.Context) error) error {
+	log := p.Logger.WithPrefixName(p.PaddedName)
+
+	for {
+		cmdctx, cancel := context.WithCancel(ctx)
+		exited := make(chan error, 1)
+		go func() {
+			exited <- command(cmdctx)
+		}()
+
+		select {
+		case err := <-exited:
+			cancel()
+			if ctx.Err() != nil {
+				return err
+			}
+
+			log.Warn(fmt.Sprintf("exited (%v), waiting for changes before restarting", err))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-p.restarts:
+			}
+		case <-p.restarts:
+			cancel()
+			<-exited
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		log.Warn("restarted by Composer")
+	}
+}
+
+// matchGlob reports whether name matches the shell pattern where `**` matches any number of directories.
+// A pattern without separator is matched against the base name only.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return len(name) == 0
+}
@@ -0,0 +1,112 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_MODIFY | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// watchFiles sends on changes the path of the files modified under the given roots using inotify.
+// skip receives the paths relative to their root.
+func watchFiles(ctx context.Context, roots []string, skip func(name string, dir bool) bool, changes chan<- string) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+
+	// A non-blocking file is handled by the runtime poller, closing it unblocks the pending read
+	f := os.NewFile(uintptr(fd), "inotify")
+	stopf := context.AfterFunc(ctx, func() {
+		f.Close() //nolint: errcheck
+	})
+	defer stopf()
+
+	type dir struct {
+		root string
+		path string
+	}
+	dirs := make(map[int]dir)
+
+	add := func(root, path string) error {
+		return filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil // Vanished or unreadable directories are ignored
+			}
+
+			rel, _ := filepath.Rel(root, path)
+			if rel != "." && skip(rel, true) {
+				return filepath.SkipDir
+			}
+
+			wd, err := unix.InotifyAddWatch(fd, path, inotifyMask)
+			if err != nil {
+				return err
+			}
+			dirs[wd] = dir{root: root, path: path}
+			return nil
+		})
+	}
+
+	for _, root := range roots {
+		if err = add(root, root); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name := bytes.TrimRight(buf[offset+unix.SizeofInotifyEvent:offset+unix.SizeofInotifyEvent+int(event.Len)], "\x00")
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+
+			d, ok := dirs[int(event.Wd)]
+			if !ok {
+				continue
+			}
+
+			if event.Mask&unix.IN_IGNORED != 0 {
+				delete(dirs, int(event.Wd))
+				continue
+			}
+
+			path := filepath.Join(d.path, string(name))
+			rel, _ := filepath.Rel(d.root, path)
+			isdir := event.Mask&unix.IN_ISDIR != 0
+
+			if skip(rel, isdir) {
+				continue
+			}
+
+			if isdir {
+				if event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+					add(d.root, path) //nolint: errcheck
+				}
+				continue
+			}
+
+			select {
+			case changes <- path:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+func watchFiles(_ context.Context, _ []string, _ func(name string, dir bool) bool, _ chan<- string) error {
+	return errors.New("watch mode is only supported on Linux")
+}